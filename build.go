@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/rs/zerolog/log"
+)
+
+// build renders the templates of a directory into a static site.
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	var opts options
+	opts.register(fs)
+	out := fs.String("out", "dist", "directory to write the site to")
+	fs.Parse(args)
+
+	h := opts.handler()
+	if err := h.Build(*out); err != nil {
+		fail("building %s:\n%v", opts.dir, err)
+	}
+	log.Info().Msgf("built %s into %s", opts.dir, *out)
+}
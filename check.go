@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+)
+
+// check checks the templates of a directory without running their queries.
+func check(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var opts options
+	opts.register(fs)
+	fs.Parse(args)
+
+	h := opts.handler()
+	if !opts.verbose {
+		zerolog.SetGlobalLevel(zerolog.ErrorLevel) // warnings are printed as diagnostics
+	}
+	diags, err := h.Check()
+	if err != nil {
+		fail("checking %s: %v", opts.dir, err)
+	}
+	var errs, warnings int
+	for _, d := range diags {
+		fmt.Println(d)
+		if d.Warning {
+			warnings++
+		} else {
+			errs++
+		}
+	}
+	if errs > 0 || warnings > 0 {
+		fmt.Fprintf(os.Stderr, "%d errors, %d warnings\n", errs, warnings)
+	}
+	if errs > 0 {
+		os.Exit(1)
+	}
+}
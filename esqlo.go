@@ -5,42 +5,150 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/masp/esqlo/esqlo"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-var (
-	addr     = flag.String("l", "127.0.0.1:8080", "address to listen on")
-	verbose  = flag.Bool("v", false, "verbose?")
-	serveDir = flag.String("s", "", "serve a directory of templates")
-)
+const usage = `usage:
+  %[1]s -s <directory of html files> [flags]       serve the templates of a directory
+  %[1]s init [directory]                          create a starter project in a directory
+  %[1]s build -s <directory> -out <directory>      render the templates of a directory into a static site
+  %[1]s check -s <directory>                       check the templates of a directory without running their queries
+  %[1]s lsp [-s <directory>]                       run a language server of the templates of a directory on stdio
+  %[1]s query [flags] <template> [name=value ...]  run the sql tags of a template and print their results
+
+Run %[1]s <command> -h for the flags of a command.
+`
+
+// options are the flags of all commands that render templates.
+type options struct {
+	dir     string
+	dataDir string
+	policy  string
+	verbose bool
+	strict  bool
+	timeout time.Duration
 
-func init() {
-	flag.StringVar(serveDir, "serve", "", "serve a directory of templates")
-	flag.StringVar(addr, "listen", "127.0.0.1:8080", "address to listen on")
+	maxRows      int
+	maxBytes     int64
+	maxPageRows  int
+	maxPageBytes int64
 }
 
-func main() {
-	flag.Parse()
-	if *serveDir == "" {
-		fmt.Fprintf(os.Stderr, "usage: %s -s <directory of html files>", os.Args[0])
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.dir, "s", "", "directory of templates")
+	fs.StringVar(&o.dir, "serve", "", "directory of templates")
+	fs.BoolVar(&o.verbose, "v", false, "verbose?")
+	fs.BoolVar(&o.strict, "strict", false, "report unresolved template variables as errors")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "default timeout of each query, 0 for none")
+	fs.StringVar(&o.dataDir, "data", "", "directory that relative paths of files in queries resolve against (default: the directory of each template)")
+	fs.StringVar(&o.policy, "policy", "", "YAML file of the policies of sources (default: duckdb is read only and sandboxed to the served directory)")
+
+	fs.IntVar(&o.maxRows, "max-rows", 10_000, "maximum number of rows of each query, 0 for no limit")
+	fs.Int64Var(&o.maxBytes, "max-bytes", 64<<20, "maximum size in bytes of the result of each query, 0 for no limit")
+	fs.IntVar(&o.maxPageRows, "max-page-rows", 100_000, "maximum number of rows of all queries of a page, 0 for no limit")
+	fs.Int64Var(&o.maxPageBytes, "max-page-bytes", 256<<20, "maximum size in bytes of the results of all queries of a page, 0 for no limit")
+}
+
+// handler sets up logging and returns a handler of the templates of the directory.
+func (o *options) handler() *esqlo.Handler {
+	if o.dir == "" {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
 		os.Exit(1)
 	}
 
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	ll := zerolog.InfoLevel
-	if *verbose {
+	if o.verbose {
 		ll = zerolog.DebugLevel
 	}
 	zerolog.SetGlobalLevel(ll)
 
-	h := esqlo.RenderAll(http.FileServer(http.Dir(*serveDir)))
+	policies := map[string]*esqlo.Policy{"duckdb": {ReadOnly: true, Sandbox: true}}
+	if o.policy != "" {
+		f, err := os.Open(o.policy)
+		if err != nil {
+			fail("%v", err)
+		}
+		policies, err = esqlo.LoadPolicies(f)
+		f.Close()
+		if err != nil {
+			fail("reading policies from %s: %v", o.policy, err)
+		}
+	}
+
+	h := esqlo.RenderAll(http.FileServer(http.Dir(o.dir)))
+	h.Strict = o.strict
+	h.Timeout = o.timeout
+	h.MaxRows, h.MaxBytes = o.maxRows, o.maxBytes
+	h.MaxPageRows, h.MaxPageBytes = o.maxPageRows, o.maxPageBytes
+	h.Policies, h.Root, h.DataDir = policies, o.dir, o.dataDir
+	return h
+}
+
+// fail prints an error and exits.
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			initProject(os.Args[2:])
+			return
+		case "build":
+			build(os.Args[2:])
+			return
+		case "check":
+			check(os.Args[2:])
+			return
+		case "lsp":
+			serveLSP(os.Args[2:])
+			return
+		case "query":
+			query(os.Args[2:])
+			return
+		case "help", "-h", "-help", "--help":
+			fmt.Fprintf(os.Stderr, usage, os.Args[0])
+			return
+		}
+	}
+	serve(os.Args[1:])
+}
+
+// serve serves the templates of a directory.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var opts options
+	opts.register(fs)
+	addr := fs.String("l", "127.0.0.1:8080", "address to listen on")
+	fs.StringVar(addr, "listen", "127.0.0.1:8080", "address to listen on")
+	authFile := fs.String("auth", "", "YAML file of the authentication of users and access rules of paths (default: no authentication)")
+	fs.Parse(args)
+
+	h := opts.handler()
+	if *authFile != "" {
+		f, err := os.Open(*authFile)
+		if err != nil {
+			fail("%v", err)
+		}
+		h.Auth, err = esqlo.LoadAuth(f, filepath.Dir(*authFile))
+		f.Close()
+		if err != nil {
+			fail("reading authentication from %s: %v", *authFile, err)
+		}
+	}
+
 	http.Handle("/", h)
 	log.Info().Msgf("listening on %s", *addr)
 	err := http.ListenAndServe(*addr, nil)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: listen and serve: %v", err)
+		fail("listen and serve: %v", err)
 	}
 }
@@ -0,0 +1,440 @@
+package esqlo
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// User is an authenticated user. Templates can show the user as {{user.name}}, {{user.id}}, {{user.tenant}} and
+// {{#user.roles}}{{.}}{{/user.roles}}, and queries can refer to the id and the tenant of the user as :user_id
+// and :tenant_id:
+//
+//	<sql src="duckdb" id="orders">SELECT * FROM orders WHERE owner = :user_id</sql>
+type User struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Roles  []string `json:"roles,omitempty"`
+	Tenant string   `json:"tenant,omitempty"` // the organization the user belongs to, for multi-tenant data
+}
+
+// Get resolves the fields of a user in templates.
+func (u *User) Get(name string) (any, bool) {
+	switch name {
+	case "id":
+		return u.ID, true
+	case "name":
+		return u.Name, true
+	case "roles":
+		return u.Roles, true
+	case "tenant":
+		return u.Tenant, true
+	}
+	return nil, false
+}
+
+// HasRole reports whether the user has any of the roles.
+func (u *User) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(u.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the user of a request. It returns nil without an error if the request carries no
+// credentials it understands, and an error if the credentials are wrong.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*User, error)
+}
+
+// Htpasswd authenticates users with HTTP basic authentication against the bcrypt hashes of an htpasswd file,
+// as created by htpasswd -B.
+type Htpasswd struct {
+	Roles   map[string][]string // the roles of each user
+	Tenants map[string]string   // the tenant of each user
+
+	hashes map[string][]byte
+}
+
+// LoadHtpasswd reads the users of an htpasswd file. Only bcrypt hashes are supported.
+func LoadHtpasswd(r io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{hashes: make(map[string][]byte)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected user:hash", line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("line %d: user %s: only bcrypt hashes are supported (htpasswd -B)", line, name)
+		}
+		h.hashes[name] = []byte(hash)
+	}
+	return h, scanner.Err()
+}
+
+func (h *Htpasswd) Authenticate(r *http.Request) (*User, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	hash, ok := h.hashes[name]
+	if !ok || bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return nil, fmt.Errorf("wrong user name or password for %q", name)
+	}
+	return &User{ID: name, Name: name, Roles: h.Roles[name], Tenant: h.Tenants[name]}, nil
+}
+
+// challenger is implemented by Authenticators that tell clients how to authenticate when they did not.
+type challenger interface {
+	challenge(w http.ResponseWriter)
+}
+
+// challenge asks browsers for a user name and password.
+func (h *Htpasswd) challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="esqlo", charset="UTF-8"`)
+}
+
+// ProxyAuth trusts a reverse proxy in front of the server to authenticate users and to pass them on in request
+// headers, e.g. oauth2-proxy with X-Forwarded-User. The headers are only trusted from the addresses in Trusted,
+// since any client can send them.
+type ProxyAuth struct {
+	UserHeader   string   `yaml:"user_header"`   // the id of the user, e.g. X-Forwarded-User
+	NameHeader   string   `yaml:"name_header"`   // the display name of the user, the id if empty
+	RolesHeader  string   `yaml:"roles_header"`  // comma separated roles of the user, e.g. X-Forwarded-Groups
+	TenantHeader string   `yaml:"tenant_header"` // the tenant of the user, e.g. X-Forwarded-Org
+	Trusted      []string `yaml:"trusted"`       // the addresses or networks of the proxies, e.g. 10.0.0.0/8
+}
+
+func (p *ProxyAuth) Authenticate(r *http.Request) (*User, error) {
+	id := r.Header.Get(p.UserHeader)
+	if id == "" {
+		return nil, nil
+	}
+	if !p.trusts(r.RemoteAddr) {
+		log.Warn().Msgf("ignoring %s header from untrusted address %s", p.UserHeader, r.RemoteAddr)
+		return nil, nil
+	}
+	u := &User{ID: id, Name: id}
+	if p.NameHeader != "" && r.Header.Get(p.NameHeader) != "" {
+		u.Name = r.Header.Get(p.NameHeader)
+	}
+	if p.TenantHeader != "" {
+		u.Tenant = r.Header.Get(p.TenantHeader)
+	}
+	if p.RolesHeader != "" {
+		for _, role := range strings.Split(r.Header.Get(p.RolesHeader), ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				u.Roles = append(u.Roles, role)
+			}
+		}
+	}
+	return u, nil
+}
+
+// trusts reports whether the remote address of a request is one of the trusted proxies.
+func (p *ProxyAuth) trusts(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, trusted := range p.Trusted {
+		if prefix, err := netip.ParsePrefix(trusted); err == nil && prefix.Contains(addr) {
+			return true
+		}
+		if a, err := netip.ParseAddr(trusted); err == nil && a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Sessions remember authenticated users in cookies signed with HMAC-SHA256, so users log in once and the
+// server does not check the password of every request.
+type Sessions struct {
+	Secret []byte        // the key of the signatures, at least 32 random bytes
+	MaxAge time.Duration // how long a session lasts, 12 hours if 0
+	Cookie string        // the name of the cookie, esqlo_session if empty
+}
+
+// session is the signed content of a session cookie.
+type session struct {
+	User    *User `json:"user"`
+	Expires int64 `json:"exp"` // unix seconds
+}
+
+func (s *Sessions) cookieName() string {
+	if s.Cookie == "" {
+		return "esqlo_session"
+	}
+	return s.Cookie
+}
+
+func (s *Sessions) maxAge() time.Duration {
+	if s.MaxAge == 0 {
+		return 12 * time.Hour
+	}
+	return s.MaxAge
+}
+
+func (s *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SetCookie starts a session of the user.
+func (s *Sessions) SetCookie(w http.ResponseWriter, r *http.Request, u *User) error {
+	expires := time.Now().Add(s.maxAge())
+	data, err := json.Marshal(session{User: u, Expires: expires.Unix()})
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    payload + "." + s.sign(payload),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Authenticate returns the user of a valid session cookie.
+func (s *Sessions) Authenticate(r *http.Request) (*User, error) {
+	c, err := r.Cookie(s.cookieName())
+	if err != nil {
+		return nil, nil
+	}
+	payload, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return nil, errors.New("invalid session cookie")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("invalid session cookie")
+	}
+	var sess session
+	if err := json.Unmarshal(data, &sess); err != nil || sess.User == nil {
+		return nil, errors.New("invalid session cookie")
+	}
+	if time.Now().Unix() > sess.Expires {
+		return nil, nil // expired, log in again
+	}
+	return sess.User, nil
+}
+
+// AccessRule restricts the paths under Path, e.g. /admin/, to users with one of Roles, to any authenticated
+// user if Roles is empty, or to anyone if Public is set.
+type AccessRule struct {
+	Path   string   `yaml:"path"`
+	Roles  []string `yaml:"roles"`
+	Public bool     `yaml:"public"`
+}
+
+// matches reports whether the rule applies to the clean path p.
+func (rule *AccessRule) matches(p string) bool {
+	prefix := path.Clean("/" + rule.Path)
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// Auth authenticates the users of a Handler and checks their access to paths. The rule with the longest path
+// that matches a request applies. Without a matching rule any authenticated user has access.
+type Auth struct {
+	Authenticators []Authenticator // tried in order until one returns a user
+	Sessions       *Sessions       // if set, users found by the Authenticators are remembered in a cookie
+	Rules          []AccessRule
+}
+
+// check authenticates the user of a request and checks the access rules. It writes an error response and
+// returns false if the request is not allowed. The user is nil for anonymous requests to public paths.
+func (a *Auth) check(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	user, err := a.authenticate(w, r)
+	if err != nil {
+		log.Info().Msgf("authentication failed for %s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	p := path.Clean("/" + r.URL.Path)
+	var rule *AccessRule
+	for i := range a.Rules {
+		if a.Rules[i].matches(p) && (rule == nil || len(a.Rules[i].Path) > len(rule.Path)) {
+			rule = &a.Rules[i]
+		}
+	}
+	switch {
+	case rule != nil && rule.Public:
+		return user, true
+	case user == nil:
+		for _, auth := range a.Authenticators {
+			if c, ok := auth.(challenger); ok {
+				c.challenge(w)
+			}
+		}
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return nil, false
+	case rule != nil && len(rule.Roles) > 0 && !user.HasRole(rule.Roles...):
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
+
+// authenticate returns the user of the session of a request, or else of the first Authenticator that knows it.
+// A trusted proxy authenticates every request, so the user of its headers takes precedence over the session and
+// replaces it if they differ, e.g. when another user signs in on the same browser or their roles changed.
+func (a *Auth) authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	var session *User
+	if a.Sessions != nil {
+		var err error
+		if session, err = a.Sessions.Authenticate(r); err != nil {
+			log.Info().Msgf("ignoring session of %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}
+	for _, auth := range a.Authenticators {
+		if _, ok := auth.(*ProxyAuth); session != nil && !ok {
+			continue
+		}
+		user, err := auth.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			continue
+		}
+		if a.Sessions != nil && !sameUser(user, session) {
+			if err := a.Sessions.SetCookie(w, r, user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	return session, nil
+}
+
+// sameUser reports whether a and b are the same user with the same roles and tenant.
+func sameUser(a, b *User) bool {
+	return a != nil && b != nil && a.ID == b.ID && a.Name == b.Name && a.Tenant == b.Tenant && slices.Equal(a.Roles, b.Roles)
+}
+
+// authConfig is the YAML configuration of LoadAuth.
+type authConfig struct {
+	Htpasswd string              `yaml:"htpasswd"`
+	Roles    map[string][]string `yaml:"roles"`
+	Tenants  map[string]string   `yaml:"tenants"`
+	Proxy    *ProxyAuth          `yaml:"proxy"`
+	Session  *struct {
+		SecretFile string        `yaml:"secret_file"`
+		MaxAge     time.Duration `yaml:"max_age"`
+		Cookie     string        `yaml:"cookie"`
+	} `yaml:"session"`
+	Rules []AccessRule `yaml:"rules"`
+}
+
+// LoadAuth reads the authentication of a Handler from YAML. Relative paths of files are relative to dir.
+//
+//	htpasswd: users.htpasswd     # basic authentication, created with htpasswd -B
+//	roles:
+//	  alice: [admin]
+//	tenants:
+//	  alice: acme
+//	proxy:                       # users authenticated by a reverse proxy
+//	  user_header: X-Forwarded-User
+//	  roles_header: X-Forwarded-Groups
+//	  trusted: [127.0.0.1, 10.0.0.0/8]
+//	session:                     # remember users in signed cookies
+//	  secret_file: session.key
+//	  max_age: 8h
+//	rules:
+//	  - path: /public/
+//	    public: true
+//	  - path: /admin/
+//	    roles: [admin]
+func LoadAuth(r io.Reader, dir string) (*Auth, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var cfg authConfig
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	resolve := func(name string) string {
+		if filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(dir, name)
+	}
+
+	auth := &Auth{Rules: cfg.Rules}
+	if cfg.Htpasswd != "" {
+		f, err := os.Open(resolve(cfg.Htpasswd))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		h, err := LoadHtpasswd(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", cfg.Htpasswd, err)
+		}
+		h.Roles, h.Tenants = cfg.Roles, cfg.Tenants
+		auth.Authenticators = append(auth.Authenticators, h)
+	}
+	if cfg.Proxy != nil {
+		if cfg.Proxy.UserHeader == "" {
+			return nil, errors.New("proxy: missing user_header")
+		}
+		for _, trusted := range cfg.Proxy.Trusted {
+			_, errPrefix := netip.ParsePrefix(trusted)
+			_, errAddr := netip.ParseAddr(trusted)
+			if errPrefix != nil && errAddr != nil {
+				return nil, fmt.Errorf("proxy: invalid trusted address %q", trusted)
+			}
+		}
+		auth.Authenticators = append(auth.Authenticators, cfg.Proxy)
+	}
+	if len(auth.Authenticators) == 0 {
+		return nil, errors.New("no authentication configured, expected htpasswd or proxy")
+	}
+	if cfg.Session != nil {
+		secret, err := os.ReadFile(resolve(cfg.Session.SecretFile))
+		if err != nil {
+			return nil, fmt.Errorf("session: %w", err)
+		}
+		secret = []byte(strings.TrimSpace(string(secret)))
+		if len(secret) < 32 {
+			return nil, errors.New("session: the secret must be at least 32 bytes long")
+		}
+		auth.Sessions = &Sessions{Secret: secret, MaxAge: cfg.Session.MaxAge, Cookie: cfg.Session.Cookie}
+	}
+	return auth, nil
+}
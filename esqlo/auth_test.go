@@ -0,0 +1,228 @@
+package esqlo
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testHtpasswd(t *testing.T) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	return "# users\nalice:" + string(hash) + "\nbob:" + string(hash) + "\n"
+}
+
+func TestHtpasswd(t *testing.T) {
+	h, err := LoadHtpasswd(strings.NewReader(testHtpasswd(t)))
+	require.NoError(t, err)
+	h.Roles = map[string][]string{"alice": {"admin"}}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	user, err := h.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	req.SetBasicAuth("alice", "secret")
+	user, err = h.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, &User{ID: "alice", Name: "alice", Roles: []string{"admin"}}, user)
+
+	req.SetBasicAuth("alice", "wrong")
+	_, err = h.Authenticate(req)
+	assert.EqualError(t, err, `wrong user name or password for "alice"`)
+
+	_, err = LoadHtpasswd(strings.NewReader("carol:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	assert.EqualError(t, err, "line 1: user carol: only bcrypt hashes are supported (htpasswd -B)")
+}
+
+func TestProxyAuth(t *testing.T) {
+	p := &ProxyAuth{UserHeader: "X-Forwarded-User", RolesHeader: "X-Forwarded-Groups", TenantHeader: "X-Forwarded-Org",
+		Trusted: []string{"10.0.0.0/8", "::1"}}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Groups", "admin, dev")
+	req.Header.Set("X-Forwarded-Org", "acme")
+
+	req.RemoteAddr = "10.1.2.3:4567"
+	user, err := p.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, &User{ID: "alice", Name: "alice", Roles: []string{"admin", "dev"}, Tenant: "acme"}, user)
+
+	req.RemoteAddr = "[::1]:4567"
+	user, _ = p.Authenticate(req)
+	assert.NotNil(t, user)
+
+	req.RemoteAddr = "192.168.1.1:4567"
+	user, err = p.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, user, "headers of untrusted clients are ignored")
+}
+
+func TestProxyAuthSessions(t *testing.T) {
+	auth := &Auth{
+		Authenticators: []Authenticator{&ProxyAuth{UserHeader: "X-Forwarded-User", RolesHeader: "X-Forwarded-Groups",
+			Trusted: []string{"192.0.2.0/24"}}},
+		Sessions: &Sessions{Secret: []byte(strings.Repeat("k", 32))},
+	}
+	request := func(user, groups string, cookie *http.Cookie) (*User, *http.Cookie) {
+		req := httptest.NewRequest("GET", "/", nil)
+		if user != "" {
+			req.Header.Set("X-Forwarded-User", user)
+			req.Header.Set("X-Forwarded-Groups", groups)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		u, err := auth.authenticate(w, req)
+		require.NoError(t, err)
+		if cookies := w.Result().Cookies(); len(cookies) > 0 {
+			return u, cookies[0]
+		}
+		return u, nil
+	}
+
+	alice, session := request("alice", "admin", nil)
+	assert.Equal(t, &User{ID: "alice", Name: "alice", Roles: []string{"admin"}}, alice)
+	require.NotNil(t, session)
+
+	user, cookie := request("", "", session)
+	assert.Equal(t, alice, user, "the session remembers the user")
+	user, cookie = request("alice", "admin", session)
+	assert.Equal(t, alice, user)
+	assert.Nil(t, cookie, "the session is not renewed if it agrees with the proxy")
+
+	user, cookie = request("alice", "", session)
+	assert.Equal(t, &User{ID: "alice", Name: "alice"}, user, "the proxy takes precedence over the session")
+	require.NotNil(t, cookie)
+	user, _ = request("", "", cookie)
+	assert.Equal(t, &User{ID: "alice", Name: "alice"}, user, "the session is replaced")
+
+	user, _ = request("bob", "", session)
+	assert.Equal(t, "bob", user.ID, "another user on the same browser")
+}
+
+func TestSessions(t *testing.T) {
+	s := &Sessions{Secret: []byte(strings.Repeat("k", 32))}
+	w := httptest.NewRecorder()
+	alice := &User{ID: "alice", Name: "Alice", Roles: []string{"admin"}}
+	require.NoError(t, s.SetCookie(w, httptest.NewRequest("GET", "/", nil), alice))
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, "esqlo_session", cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	user, err := s.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, alice, user)
+
+	tampered := *cookie
+	tampered.Value = strings.Replace(cookie.Value, cookie.Value[:4], "eyJ1", 1) + "x"
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&tampered)
+	_, err = s.Authenticate(req)
+	assert.EqualError(t, err, "invalid session cookie")
+
+	expired := &Sessions{Secret: s.Secret, MaxAge: -time.Minute}
+	w = httptest.NewRecorder()
+	require.NoError(t, expired.SetCookie(w, httptest.NewRequest("GET", "/", nil), alice))
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	user, err = s.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func TestHandlerAuth(t *testing.T) {
+	h, err := LoadHtpasswd(strings.NewReader(testHtpasswd(t)))
+	require.NoError(t, err)
+	h.Roles = map[string][]string{"alice": {"admin"}}
+	db := &MemDB{Tables: map[string]*MemTable{
+		"orders": {Columns: []string{"owner", "item"}, Rows: [][]any{{"alice", "tea"}, {"bob", "cake"}}},
+	}}
+	handler := &Handler{
+		Databases: map[string]Database{ImplicitDb: db},
+		Auth: &Auth{
+			Authenticators: []Authenticator{h},
+			Sessions:       &Sessions{Secret: []byte(strings.Repeat("k", 32))},
+			Rules: []AccessRule{
+				{Path: "/public", Public: true},
+				{Path: "/admin/", Roles: []string{"admin"}},
+			},
+		},
+		fileserver: &bufHandler{resp: []byte(`Hi {{user.name}}{{#orders}} {{item}}{{/orders}}<sql id="orders">SELECT item FROM orders WHERE owner = :user_id</sql>`)},
+	}
+	get := func(path, user string, cookies ...*http.Cookie) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, "secret")
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+	body := func(resp *http.Response) string {
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	resp := get("/index.html", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Basic realm="esqlo", charset="UTF-8"`, resp.Header.Get("WWW-Authenticate"))
+
+	resp = get("/index.html", "bob")
+	assert.Equal(t, "Hi bob cake", body(resp))
+	session := resp.Cookies()[0]
+	assert.Equal(t, "Hi bob cake", body(get("/index.html", "", session)), "the session remembers the user")
+
+	assert.Equal(t, http.StatusForbidden, get("/admin/index.html", "bob").StatusCode)
+	assert.Equal(t, "Hi alice tea", body(get("/admin/index.html", "alice")))
+	assert.Equal(t, "Hi ", body(get("/public/index.html", "")), ":user_id is NULL for anonymous users")
+}
+
+func TestLoadAuth(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "users.htpasswd"), []byte(testHtpasswd(t)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "session.key"), []byte(strings.Repeat("k", 32)+"\n"), 0o600))
+
+	auth, err := LoadAuth(strings.NewReader(`
+htpasswd: users.htpasswd
+roles:
+  alice: [admin]
+proxy:
+  user_header: X-Forwarded-User
+  trusted: [127.0.0.1]
+session:
+  secret_file: session.key
+  max_age: 8h
+rules:
+  - path: /admin/
+    roles: [admin]
+`), dir)
+	require.NoError(t, err)
+	require.Len(t, auth.Authenticators, 2)
+	assert.Equal(t, map[string][]string{"alice": {"admin"}}, auth.Authenticators[0].(*Htpasswd).Roles)
+	assert.Equal(t, &ProxyAuth{UserHeader: "X-Forwarded-User", Trusted: []string{"127.0.0.1"}}, auth.Authenticators[1])
+	assert.Equal(t, &Sessions{Secret: []byte(strings.Repeat("k", 32)), MaxAge: 8 * time.Hour}, auth.Sessions)
+	assert.Equal(t, []AccessRule{{Path: "/admin/", Roles: []string{"admin"}}}, auth.Rules)
+
+	_, err = LoadAuth(strings.NewReader("rules: []\n"), dir)
+	assert.EqualError(t, err, "no authentication configured, expected htpasswd or proxy")
+	_, err = LoadAuth(strings.NewReader("proxy:\n  user_header: X-User\n  trusted: [localhost]\n"), dir)
+	assert.EqualError(t, err, `proxy: invalid trusted address "localhost"`)
+}
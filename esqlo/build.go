@@ -0,0 +1,150 @@
+package esqlo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Build renders every template of Root into a static site in the directory out, which any static file host can
+// serve. Other files are copied as they are, except partials (*.mustache), which are part of the templates. Dynamic
+// routes are rendered once for every row of their routes tag, e.g. restaurants/[name].html into
+// restaurants/McDonalds.html, see matchRoute.
+//
+// Pages are rendered for an anonymous user, and only the first page of paginated tags is rendered. Build
+// renders all pages and returns the errors of all of them, so the site must not be published if it fails.
+func (d *Handler) Build(out string) error {
+	if d.Root == "" {
+		return errors.New("building needs the directory of the templates as Root")
+	}
+	absRoot, err := filepath.Abs(d.Root)
+	if err != nil {
+		return err
+	}
+	absOut, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	if isInside(absOut, absRoot) {
+		return fmt.Errorf("the output directory %s must not be inside of %s", out, d.Root)
+	}
+
+	var errs []error
+	err = filepath.WalkDir(d.Root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case e.IsDir() || strings.HasSuffix(rel, ".mustache"):
+			return nil // directories are created for the files inside
+		case !strings.HasSuffix(rel, ".html"):
+			if isDynamic(rel) {
+				log.Warn().Msgf("skipping %s: only templates can be in dynamic directories", rel)
+				return nil
+			}
+			if d.hidesData(rel) {
+				log.Warn().Msgf("skipping %s: data files are not published when sources have setup statements", rel)
+				return nil
+			}
+			return copyFile(p, filepath.Join(out, rel))
+		case isDynamic(rel):
+			errs = append(errs, d.buildRoutes(rel, out)...)
+		default:
+			if err := d.buildPage(rel, rel, nil, out); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// buildRoutes renders a page of a dynamic route for every row of its routes tag.
+func (d *Handler) buildRoutes(tmpl, out string) []error {
+	src, err := os.ReadFile(filepath.Join(d.Root, filepath.FromSlash(tmpl)))
+	if err != nil {
+		return []error{err}
+	}
+	render := d.Renderer(&url.URL{Path: "/" + tmpl}, "/"+tmpl, nil, nil)
+	render.RoutesOnly = true
+	if err := render.RenderHTMLContext(context.Background(), bytes.NewReader(src), io.Discard); err != nil {
+		return []error{fmt.Errorf("%s: listing routes:\n%w", tmpl, err)}
+	}
+	routes := render.Routes()
+	if routes == nil {
+		return []error{fmt.Errorf("%s: a dynamic route needs a sql tag with the routes attribute to list its pages", tmpl)}
+	}
+
+	var errs []error
+	for _, row := range routes {
+		page, params, err := expandRoute(tmpl, row.(map[string]any))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tmpl, err))
+			continue
+		}
+		if err := d.buildPage(tmpl, page, params, out); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// buildPage renders the template tmpl as the page at the path page of out.
+func (d *Handler) buildPage(tmpl, page string, params map[string]string, out string) error {
+	src, err := os.Open(filepath.Join(d.Root, filepath.FromSlash(tmpl)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var buf bytes.Buffer
+	render := d.Renderer(&url.URL{Path: "/" + page}, "/"+tmpl, nil, params)
+	if err := render.RenderHTMLContext(context.Background(), src, &buf); err != nil {
+		return fmt.Errorf("%s:\n%w", page, err)
+	}
+	dst := filepath.Join(out, filepath.FromSlash(page))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	log.Debug().Msgf("built %s", path.Join(out, page))
+	return os.WriteFile(dst, buf.Bytes(), 0o644)
+}
+
+// copyFile copies the file src to dst.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
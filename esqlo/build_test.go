@@ -0,0 +1,128 @@
+package esqlo
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSite writes the files of a site into a temporary directory.
+func testSite(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	return root
+}
+
+var restaurantsDb = &MemDB{Tables: map[string]*MemTable{
+	"reviews": {
+		Columns: []string{"restaurant", "stars"},
+		Rows:    [][]any{{"McDonalds", 5}, {"McDonalds", 1}, {"Wendys", 4}},
+	},
+}}
+
+const restaurantTemplate = `<sql id="restaurants" routes>SELECT DISTINCT restaurant AS name FROM reviews</sql>` +
+	`<sql id="reviews">SELECT stars FROM reviews WHERE restaurant = :name</sql>` +
+	`{{params.name}}:{{#reviews}} {{stars}}{{/reviews}}`
+
+func TestBuild(t *testing.T) {
+	root := testSite(t, map[string]string{
+		"index.html":                  `<sql id="n">SELECT count(*) AS n FROM reviews</sql>{{n[0].n}} reviews`,
+		"style.css":                   `body {}`,
+		"restaurants/[name].html":     restaurantTemplate,
+		"restaurants/[name]/logo.png": `skipped`,
+	})
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	h.Databases = map[string]Database{ImplicitDb: restaurantsDb}
+
+	out := filepath.Join(t.TempDir(), "dist")
+	require.NoError(t, h.Build(out))
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "3 reviews", read("index.html"))
+	assert.Equal(t, "body {}", read("style.css"))
+	assert.Equal(t, "McDonalds: 5 1", read("restaurants/McDonalds.html"))
+	assert.Equal(t, "Wendys: 4", read("restaurants/Wendys.html"))
+	assert.NoDirExists(t, filepath.Join(out, "restaurants", "[name]"))
+
+	assert.EqualError(t, h.Build(filepath.Join(root, "dist")), "the output directory "+filepath.Join(root, "dist")+" must not be inside of "+root)
+}
+
+func TestBuildErrors(t *testing.T) {
+	root := testSite(t, map[string]string{
+		"index.html":     `<sql id="n">SELECT * FROM nope</sql>`,
+		"ok.html":        `ok`,
+		"[missing].html": `no routes`,
+	})
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	h.Databases = map[string]Database{ImplicitDb: restaurantsDb}
+
+	out := t.TempDir()
+	err := h.Build(out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[missing].html: a dynamic route needs a sql tag with the routes attribute to list its pages")
+	assert.Contains(t, err.Error(), "index.html:\n")
+	assert.FileExists(t, filepath.Join(out, "ok.html"), "the other pages are still built")
+}
+
+func TestHandleDynamicRoute(t *testing.T) {
+	root := testSite(t, map[string]string{
+		"restaurants/[name].html": restaurantTemplate,
+		"shops/[Name].html":       `<sql id="reviews">SELECT stars FROM reviews WHERE restaurant = :Name</sql>{{#reviews}}{{stars}}{{/reviews}}`,
+	})
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	h.Databases = map[string]Database{ImplicitDb: restaurantsDb}
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body, err := io.ReadAll(w.Result().Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "McDonalds: 5 1", get("/restaurants/McDonalds.html"))
+	assert.Equal(t, "4", get("/shops/Wendys.html"))
+
+	for _, path := range []string{"/menus/McDonalds.html", "/restaurants/%5Bname%5D.html"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, path)
+	}
+}
+
+func TestHideDataFiles(t *testing.T) {
+	root := testSite(t, map[string]string{"orders.csv": "tenant,item\nacme,tea\n", "style.css": "body {}"})
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result().StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get("/orders.csv"))
+
+	h.Policies = map[string]*Policy{"duckdb": {Setup: []string{"CREATE TEMP VIEW my_orders AS SELECT * FROM orders WHERE tenant = :tenant_id"}}}
+	assert.Equal(t, http.StatusNotFound, get("/orders.csv"), "downloading the data would bypass the setup statements")
+	assert.Equal(t, http.StatusOK, get("/style.css"))
+
+	out := filepath.Join(t.TempDir(), "dist")
+	require.NoError(t, h.Build(out))
+	assert.NoFileExists(t, filepath.Join(out, "orders.csv"))
+	assert.FileExists(t, filepath.Join(out, "style.css"))
+}
@@ -0,0 +1,96 @@
+package esqlo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a problem of a template found by Handler.Check.
+type Diagnostic struct {
+	File      string // the path of the template
+	Line, Col int
+	Msg       string
+	Warning   bool // the problem does not break the page, e.g. a query that could not be checked
+}
+
+func (d Diagnostic) String() string {
+	severity := "error"
+	if d.Warning {
+		severity = "warning"
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Col, severity, d.Msg)
+}
+
+// Check checks every template of Root without running its queries and returns the problems found, sorted by
+// file and position: malformed sql tags, sources that cannot be loaded, queries that the database or the policy
+// of their source rejects, and mustache tags that refer to tables or columns that do not exist. See
+// Renderer.Check.
+func (d *Handler) Check() ([]Diagnostic, error) {
+	if d.Root == "" {
+		return nil, fmt.Errorf("checking needs the directory of the templates as Root")
+	}
+	var diags []Diagnostic
+	err := filepath.WalkDir(d.Root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() || !strings.HasSuffix(p, ".html") {
+			return err
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		diags = append(diags, d.CheckTemplate(filepath.ToSlash(rel), f)...)
+		return nil
+	})
+	return diags, err
+}
+
+// CheckTemplate checks the template at the path tmpl relative to Root with the source src, which need not be
+// saved yet, e.g. in an editor. The File of the diagnostics is the path of the template in Root.
+//
+// The template is checked for a logged in user without roles, and the parameters of dynamic routes are empty.
+func (d *Handler) CheckTemplate(tmpl string, src io.Reader) []Diagnostic {
+	diags, _ := d.InspectTemplate(tmpl, src)
+	return diags
+}
+
+// InspectTemplate is like CheckTemplate but also returns the loaded sql tags of the template, whose results
+// have the columns of their queries, e.g. to complete the names of tables and columns in an editor.
+func (d *Handler) InspectTemplate(tmpl string, src io.Reader) ([]Diagnostic, []*SqlTag) {
+	params := make(map[string]string)
+	for _, segment := range strings.Split(tmpl, "/") {
+		if name, _, ok := segmentParam(segment); ok {
+			params[name] = ""
+		}
+	}
+	render := d.Renderer(&url.URL{Path: "/" + tmpl}, "/"+tmpl, &User{}, params)
+	render.Check, render.Strict = true, true
+	render.RenderHTMLContext(context.Background(), src, io.Discard)
+
+	file := filepath.Join(d.Root, filepath.FromSlash(tmpl))
+	var diags []Diagnostic
+	for _, e := range render.Errors {
+		diags = append(diags, Diagnostic{File: file, Line: e.Line, Col: e.Col, Msg: e.Msg.Error()})
+	}
+	for _, w := range render.Warnings {
+		diags = append(diags, Diagnostic{File: file, Line: w.Line, Col: w.Col, Msg: w.Msg.Error(), Warning: true})
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Col < diags[j].Col
+	})
+	return diags, render.Tags()
+}
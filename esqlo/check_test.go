@@ -0,0 +1,43 @@
+package esqlo
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	root := testSite(t, map[string]string{
+		"ok.html": `<sql id="reviews" paginate="10">SELECT restaurant, stars FROM reviews</sql>
+{{#reviews}}{{#if stars > 3}}{{restaurant}}{{else}}{{stars}}{{/if}}{{/reviews}}{{reviews.$page}}{{user.name}}`,
+		"restaurants/[name].html": restaurantTemplate,
+		"bad.html": `<sql src="nope" id="a">SELECT 1</sql>
+<sql>SELECT stars FROM reviews</sql>
+<sql id="b">SELECT strs FROM reviews</sql>
+<sql id="c">SELECT stars FROM reviews</sql>
+{{#c}}{{#if stars > 3}}{{stras}}{{/if}}{{/c}}{{d}}
+<sql id="d">SELECT 1`,
+	})
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	h.Databases = map[string]Database{ImplicitDb: restaurantsDb}
+
+	diags, err := h.Check()
+	require.NoError(t, err)
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	bad := filepath.Join(root, "bad.html")
+	assert.Equal(t, []string{
+		bad + ":1:1: error: loading database: unknown database: nope",
+		bad + ":2:1: error: missing required 'id' attribute",
+		bad + ":3:13: error: checking query: column \"strs\" not found",
+		bad + `:5:24: error: unknown variable "stras" (did you mean "stars"?)`,
+		bad + `:5:46: error: unknown variable "d" (did you mean "c"?)`,
+		bad + ":6:13: error: unclosed sql tag, expected </sql>",
+	}, got)
+}
@@ -1,13 +1,13 @@
 package esqlo
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/url"
 
 	"database/sql"
 
-	_ "github.com/marcboeker/go-duckdb"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,10 +17,46 @@ const (
 
 type Database interface {
 	OpenConnection(path *url.URL) error
-	Query(query string) (*Result, error)
+	// Query runs a query and returns its result, truncated to the limits of opts. It stops and returns the
+	// error of ctx if ctx is canceled or times out before the query finishes.
+	Query(ctx context.Context, query string, opts QueryOptions) (*Result, error)
 	Close() error
 }
 
+// Sessioner is implemented by databases that can run the queries of a page in a session of their own, e.g. on
+// a single connection, so settings and temporary views of the setup of the session only apply to that page.
+// Setup statements typically restrict the data to the user of the page, see Policy.Setup.
+type Sessioner interface {
+	// Session runs the setup statements in a new session and returns a database that runs queries in that
+	// session. Closing the returned database ends the session.
+	Session(ctx context.Context, setup []Statement) (Database, error)
+}
+
+// Describer is implemented by databases that can check a query without running it, see Renderer.Check.
+type Describer interface {
+	// Describe checks a query with the values of its ? placeholders and returns a result with its columns and
+	// no rows. The result is nil if the query is valid but its columns are unknown.
+	Describe(ctx context.Context, query string, args []any) (*Result, error)
+}
+
+// Statement is a query with the values of its ? placeholders.
+type Statement struct {
+	Query string
+	Args  []any
+}
+
+var drivers = make(map[string]func() Database)
+
+// RegisterDriver makes a database backend available to sql tags with a src of name, e.g. src="duckdb" or
+// src="duckdb://data.db". Backends that need CGO only register themselves in files with the cgo build
+// constraint, so the package still builds with CGO_ENABLED=0, just without them.
+func RegisterDriver(name string, newDb func() Database) {
+	if _, ok := drivers[name]; ok {
+		panic("esqlo: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = newDb
+}
+
 func LoadConfigs(r io.Reader) (map[string]Database, error) {
 	var root map[string]yaml.Node
 	err := yaml.NewDecoder(r).Decode(&root)
@@ -62,11 +98,6 @@ func loadCfgNode(node yaml.Node) (Database, error) {
 	}
 }
 
-type Result struct {
-	Columns []string
-	Rows    []any // each row with a slice of values for each row. len(rows) == number of results, len(rows[0]) == len(ColumnNames)
-}
-
 type Sqlite struct {
 	Path string `yaml:"path"`
 }
@@ -75,59 +106,29 @@ func (s *Sqlite) OpenConnection(path *url.URL) error {
 	return nil
 }
 
-type DuckDB struct {
-	conn *sql.DB
-}
-
-func (d *DuckDB) OpenConnection(path *url.URL) (err error) {
-	if path.Scheme == "duckdb" {
-		path.Path = path.Host + path.Path
-	} else {
-		path.Path = ""
-	}
-
-	d.conn, err = sql.Open("duckdb", path.Path)
-	return err
-}
-
-func (d *DuckDB) Query(query string) (*Result, error) {
-	rows, err := d.conn.Query(query)
-	if err == sql.ErrNoRows {
-		cols, err := rows.Columns()
-		return &Result{Columns: cols}, err
-	} else if err != nil {
-		return nil, err
-	}
-
-	cols, err := rows.Columns()
-	if err != nil {
-		return nil, err
-	}
-	result, err := readRows(cols, rows)
-	return &Result{Columns: cols, Rows: result}, err
-}
-
-func (d *DuckDB) Close() error {
-	return d.conn.Close()
-}
-
-func readRows(cols []string, rows *sql.Rows) (result []any, err error) {
+// readRows reads the values of the rows in the order of the columns and normalizes them, see Normalize. It stops
+// reading and reports that the rows are truncated when the limits of opts are reached.
+func readRows(rows *sql.Rows, types []ColumnType, convert converter, opts QueryOptions) (result [][]any, truncated bool, err error) {
+	limiter := rowLimiter{opts: opts}
 	for rows.Next() {
 		var rowvals []any // ptr to any
-		for i := 0; i < len(cols); i++ {
+		for i := 0; i < len(types); i++ {
 			var val any
 			rowvals = append(rowvals, &val)
 		}
 		err := rows.Scan(rowvals...)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
-		values := make(map[string]any)
-		for i, col := range cols {
-			values[col] = *rowvals[i].(*any)
+		values := make([]any, len(types))
+		for i, t := range types {
+			values[i] = normalizeColumn(t.Type, *rowvals[i].(*any), convert)
+		}
+		if !limiter.add(values) {
+			return result, true, nil
 		}
 		result = append(result, values)
 	}
-	return result, nil
+	return result, false, rows.Err()
 }
@@ -1,7 +1,9 @@
 package esqlo
 
 import (
+	"bytes"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,32 +41,63 @@ func parseUrl(s string) *url.URL {
 	return u
 }
 
-func TestReadDuckDb(t *testing.T) {
-	db := &DuckDB{}
-	err := db.OpenConnection(parseUrl("duckdb://./testdata/people.duckdb"))
-	require.NoError(t, err)
-	defer db.Close()
+func TestLoadDatabase(t *testing.T) {
+	RegisterDriver("memtest", func() Database { return &MemDB{} })
+	defer delete(drivers, "memtest")
 
-	res, err := db.Query("SELECT id, name FROM people")
+	renderer := NewRenderer()
+	db, err := renderer.LoadDatabase(parseUrl("memtest://data"))
 	require.NoError(t, err)
-	assert.Equal(t, []string{"id", "name"}, res.Columns)
-	assert.Equal(t, []any{
-		map[string]any{"name": "John", "id": int32(42)},
-		map[string]any{"name": "Jane", "id": int32(41)},
-	}, res.Rows)
+	assert.IsType(t, &MemDB{}, db)
+
+	_, err = renderer.LoadDatabase(parseUrl("nope"))
+	assert.EqualError(t, err, "unknown database: nope")
+	assert.Panics(t, func() { RegisterDriver("memtest", nil) })
 }
 
-func TestReadCsv(t *testing.T) {
-	db := &DuckDB{}
-	err := db.OpenConnection(parseUrl("duckdb"))
-	require.NoError(t, err)
-	defer db.Close()
+// countingDb counts how often databases of a driver are opened and closed.
+type countingDb struct {
+	*MemDB
+	opened, closed *int
+}
 
-	res, err := db.Query("SELECT id, name FROM 'testdata/people.csv'")
-	require.NoError(t, err)
-	assert.Equal(t, []string{"id", "name"}, res.Columns)
-	assert.Equal(t, []any{
-		map[string]any{"name": "John", "id": int64(42)},
-		map[string]any{"name": "Jane", "id": int64(41)},
-	}, res.Rows)
+func (c countingDb) OpenConnection(*url.URL) error {
+	*c.opened++
+	return nil
+}
+
+func (c countingDb) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestRenderClosesDatabases(t *testing.T) {
+	var opened, closed int
+	RegisterDriver("counttest", func() Database {
+		return countingDb{MemDB: &MemDB{Tables: map[string]*MemTable{"t": {Columns: []string{"a"}, Rows: [][]any{{1}}}}},
+			opened: &opened, closed: &closed}
+	})
+	defer delete(drivers, "counttest")
+
+	renderer := NewRenderer()
+	src := `<sql src="counttest://a" id="x">SELECT a FROM t</sql><sql src="counttest://a" id="y">SELECT a FROM t</sql>` +
+		`<sql src="counttest://b" id="z">SELECT a FROM t</sql>{{x[0].a}}{{y[0].a}}{{z[0].a}}`
+	var out bytes.Buffer
+	require.NoError(t, renderer.RenderHTML(strings.NewReader(src), &out))
+	assert.Equal(t, "111", out.String())
+	assert.Equal(t, 2, opened, "tags of the same source share its database")
+	assert.Equal(t, 2, closed, "the databases are closed when the page is rendered")
+}
+
+func TestImplicitDatabase(t *testing.T) {
+	var opened, closed int
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = countingDb{
+		MemDB:  &MemDB{Tables: map[string]*MemTable{"t": {Columns: []string{"a"}, Rows: [][]any{{1}}}}},
+		opened: &opened, closed: &closed,
+	}
+	var out bytes.Buffer
+	require.NoError(t, renderer.RenderHTML(strings.NewReader(`<sql id="x">SELECT a FROM t</sql>{{x[0].a}}`), &out))
+	assert.Equal(t, "1", out.String(), "databases other than MemDB are queried as they are")
+	assert.Zero(t, closed, "the configured database is not closed")
 }
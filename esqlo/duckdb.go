@@ -0,0 +1,220 @@
+//go:build cgo
+
+package esqlo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+)
+
+func init() {
+	RegisterDriver("duckdb", func() Database { return &DuckDB{} })
+}
+
+type DuckDB struct {
+	conn *sql.DB
+}
+
+func (d *DuckDB) OpenConnection(path *url.URL) (err error) {
+	if path.Scheme == "duckdb" {
+		path.Path = path.Host + path.Path
+	} else {
+		path.Path = ""
+	}
+
+	dsn := path.Path
+	if path.RawQuery != "" {
+		dsn += "?" + path.RawQuery // settings, e.g. ?access_mode=READ_ONLY&enable_external_access=false
+	}
+	d.conn, err = sql.Open("duckdb", dsn)
+	return err
+}
+
+// readsFiles marks DuckDB as a database that reads the files named in queries, e.g. SELECT * FROM 'data.csv'.
+func (d *DuckDB) readsFiles() {}
+
+func (d *DuckDB) Query(ctx context.Context, query string, opts QueryOptions) (*Result, error) {
+	return queryDuckDB(ctx, d.conn, query, opts)
+}
+
+// Session runs the setup statements on a connection of its own, which runs the queries of the session. Setup
+// statements can create temporary views that only this connection sees, e.g. CREATE TEMP VIEW orders AS
+// SELECT * FROM main.orders WHERE tenant = ?. Since DuckDB does not allow placeholders in such statements,
+// their arguments are inlined as literals.
+func (d *DuckDB) Session(ctx context.Context, setup []Statement) (Database, error) {
+	conn, err := d.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range setup {
+		query, err := inlineArgs(stmt.Query, stmt.Args)
+		if err == nil {
+			_, err = conn.ExecContext(ctx, query)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &duckDBSession{conn: conn}, nil
+}
+
+// duckDBSession runs queries on the connection of a session, see DuckDB.Session.
+type duckDBSession struct {
+	conn *sql.Conn
+}
+
+func (s *duckDBSession) OpenConnection(path *url.URL) error {
+	return nil
+}
+
+func (s *duckDBSession) Query(ctx context.Context, query string, opts QueryOptions) (*Result, error) {
+	return queryDuckDB(ctx, s.conn, query, opts)
+}
+
+func (s *duckDBSession) readsFiles() {}
+
+func (s *duckDBSession) Close() error {
+	return s.conn.Close()
+}
+
+func (d *DuckDB) Describe(ctx context.Context, query string, args []any) (*Result, error) {
+	return describeDuckDB(ctx, d.conn, query, args)
+}
+
+func (s *duckDBSession) Describe(ctx context.Context, query string, args []any) (*Result, error) {
+	return describeDuckDB(ctx, s.conn, query, args)
+}
+
+// describeDuckDB returns the columns of a SELECT query with DESCRIBE, and checks other queries with EXPLAIN,
+// which plans a query without running it. DESCRIBE and SHOW statements cannot be explained and are not checked.
+func describeDuckDB(ctx context.Context, conn queryer, query string, args []any) (*Result, error) {
+	toks, err := scanSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	stmts := splitStatements(toks)
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("expected a single statement, got %d", len(stmts))
+	}
+	switch statementKind(stmts[0]) {
+	case "SELECT":
+	case "DESCRIBE", "SHOW":
+		return nil, nil
+	default:
+		query, err := inlineArgs(query, args) // EXPLAIN does not take placeholders
+		if err != nil {
+			return nil, err
+		}
+		rows, err := conn.QueryContext(ctx, "EXPLAIN "+query)
+		if err != nil {
+			return nil, err
+		}
+		return nil, rows.Close()
+	}
+
+	rows, err := conn.QueryContext(ctx, "DESCRIBE "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	var types []ColumnType
+	for rows.Next() {
+		var name, typ string
+		var null, key, def, extra any
+		if err := rows.Scan(&name, &typ, &null, &key, &def, &extra); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+		types = append(types, ColumnType{Name: name, Type: typ, Nullable: null != "NO", Numeric: isNumericType(typ)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return NewResult(cols, types, nil), nil
+}
+
+// queryer is a *sql.DB or a *sql.Conn.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryDuckDB runs a query on a database or a connection of DuckDB.
+func queryDuckDB(ctx context.Context, conn queryer, query string, opts QueryOptions) (*Result, error) {
+	rows, err := conn.QueryContext(ctx, query, opts.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	sqlTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := columnTypes(sqlTypes)
+	values, truncated, err := readRows(rows, types, convertDuckDB, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := NewResult(cols, types, values)
+	res.Truncated = truncated
+	return res, nil
+}
+
+// convertDuckDB converts the DuckDB specific types: decimals, intervals and UUIDs.
+func convertDuckDB(typ string, v any) (any, bool) {
+	switch v := v.(type) {
+	case duckdb.Decimal:
+		return Decimal{Value: v.Value, Scale: int(v.Scale)}, true
+	case duckdb.Interval:
+		return formatInterval(v), true
+	case []byte:
+		if typ == "UUID" && len(v) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16]), true
+		}
+	}
+	return nil, false
+}
+
+// formatInterval formats an interval like DuckDB, e.g. "1 year 2 months 3 days 04:05:06.5".
+func formatInterval(iv duckdb.Interval) string {
+	var parts []string
+	plural := func(n int64, unit string) {
+		if n == 1 || n == -1 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+		} else if n != 0 {
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit))
+		}
+	}
+	plural(int64(iv.Months/12), "year")
+	plural(int64(iv.Months%12), "month")
+	plural(int64(iv.Days), "day")
+	if iv.Micros != 0 || len(parts) == 0 {
+		d := time.Duration(iv.Micros) * time.Microsecond
+		sign := ""
+		if d < 0 {
+			sign, d = "-", -d
+		}
+		clock := fmt.Sprintf("%s%02d:%02d:%02d", sign, int64(d/time.Hour), int64(d/time.Minute%60), int64(d/time.Second%60))
+		if frac := d % time.Second; frac != 0 {
+			clock += strings.TrimRight(fmt.Sprintf(".%06d", frac/time.Microsecond), "0")
+		}
+		parts = append(parts, clock)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (d *DuckDB) Close() error {
+	return d.conn.Close()
+}
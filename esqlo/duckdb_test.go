@@ -0,0 +1,275 @@
+//go:build cgo
+
+package esqlo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDuckDb(t *testing.T) {
+	db := &DuckDB{}
+	err := db.OpenConnection(parseUrl("duckdb://./testdata/people.duckdb"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	res, err := db.Query(context.Background(), "SELECT id, name FROM people", QueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, res.Columns)
+	assert.Equal(t, []any{
+		map[string]any{"name": "John", "id": int64(42)},
+		map[string]any{"name": "Jane", "id": int64(41)},
+	}, res.Rows)
+	assert.Equal(t, [][]any{{int64(42), "John"}, {int64(41), "Jane"}}, res.Values)
+	assert.Equal(t, []ColumnType{
+		{Name: "id", Type: "INTEGER", Nullable: true, Numeric: true},
+		{Name: "name", Type: "VARCHAR", Nullable: true},
+	}, res.ColumnTypes)
+}
+
+func TestReadCsv(t *testing.T) {
+	db := &DuckDB{}
+	err := db.OpenConnection(parseUrl("duckdb"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	res, err := db.Query(context.Background(), "SELECT id, name FROM 'testdata/people.csv'", QueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, res.Columns)
+	assert.Equal(t, []any{
+		map[string]any{"name": "John", "id": int64(42)},
+		map[string]any{"name": "Jane", "id": int64(41)},
+	}, res.Rows)
+}
+
+func TestQueryResultsAcrossSources(t *testing.T) {
+	renderer := NewRenderer()
+
+	var out bytes.Buffer
+	src := `<sql src="duckdb" id="people">SELECT * FROM 'testdata/people.csv'</sql><sql id="names">SELECT name FROM people</sql>{{#names}}{{name}},{{/names}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, `John,Jane,`, out.String())
+}
+
+func TestDuckDbTypes(t *testing.T) {
+	db := &DuckDB{}
+	err := db.OpenConnection(parseUrl("duckdb"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	res, err := db.Query(context.Background(), `SELECT
+		1::TINYINT AS tiny, 2::INTEGER AS int, 3::BIGINT AS big, 170141183460469231731687303715884105727::HUGEINT AS huge,
+		1.5::FLOAT AS float, 12.50::DECIMAL(10,2) AS dec, 'hi' AS str, true AS bool, NULL AS nothing,
+		'\xAA'::BLOB AS blob, DATE '2024-01-02' AS date, TIME '03:04:05' AS time,
+		TIMESTAMP '2024-01-02 03:04:05.25' AS ts, INTERVAL '1 year 2 months 3 days 4 hours' AS iv,
+		'6ba7b810-9dad-11d1-80b4-00c04fd430c8'::UUID AS uuid, [1, 2] AS list, {'a': 1.5::DECIMAL(3,1)} AS struct,
+		MAP {'k': 1} AS map`, QueryOptions{})
+	require.NoError(t, err)
+
+	formatted := make(map[string]string)
+	for i, v := range res.Values[0] {
+		formatted[res.Columns[i]] = fmt.Sprint(v)
+	}
+	assert.Equal(t, map[string]string{
+		"tiny":    "1",
+		"int":     "2",
+		"big":     "3",
+		"huge":    "170141183460469231731687303715884105727",
+		"float":   "1.5",
+		"dec":     "12.50",
+		"str":     "hi",
+		"bool":    "true",
+		"nothing": "<nil>",
+		"blob":    `\xaa`,
+		"date":    "2024-01-02",
+		"time":    "03:04:05",
+		"ts":      "2024-01-02 03:04:05.25",
+		"iv":      "1 year 2 months 3 days 04:00:00",
+		"uuid":    "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"list":    "[1 2]",
+		"struct":  "map[a:1.5]",
+		"map":     "map[k:1]",
+	}, formatted)
+
+	assert.IsType(t, int64(0), res.Values[0][0])
+	assert.IsType(t, Decimal{}, res.Values[0][3])
+	assert.IsType(t, Decimal{}, res.Values[0][5])
+	assert.IsType(t, Time{}, res.Values[0][10])
+	assert.Equal(t, []any{int64(1), int64(2)}, res.Values[0][15])
+}
+
+func TestRenderNestedColumns(t *testing.T) {
+	renderer := NewRenderer()
+
+	var out bytes.Buffer
+	src := `<sql src="duckdb" id="r">SELECT ['fast', 'cheap'] AS tags, {'visits': 2, 'city': 'Paris'} AS meta</sql>` +
+		`{{#r}}{{#tags}}{{.}} {{/tags}}{{#meta}}{{city}} {{visits}}{{/meta}}{{/r}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, `fast cheap Paris 2`, out.String())
+}
+
+func TestDuckDbLimits(t *testing.T) {
+	db := &DuckDB{}
+	err := db.OpenConnection(parseUrl("duckdb"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	res, err := db.Query(context.Background(), "SELECT * FROM range(1000000)", QueryOptions{MaxRows: 10})
+	require.NoError(t, err)
+	assert.Len(t, res.Values, 10)
+	assert.True(t, res.Truncated)
+
+	res, err = db.Query(context.Background(), "SELECT repeat('x', 100) AS s FROM range(100)", QueryOptions{MaxBytes: 1000})
+	require.NoError(t, err)
+	assert.Len(t, res.Values, 8)
+	assert.True(t, res.Truncated)
+
+	res, err = db.Query(context.Background(), "SELECT * FROM range(10)", QueryOptions{MaxRows: 10})
+	require.NoError(t, err)
+	assert.Len(t, res.Values, 10)
+	assert.False(t, res.Truncated)
+}
+
+func TestDuckDbPolicy(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Root = "testdata"
+	renderer.Policies = map[string]*Policy{"duckdb": {ReadOnly: true, Sandbox: true}}
+	var out bytes.Buffer
+	src := `<sql src="duckdb" id="people">SELECT name FROM 'testdata/people.csv'</sql>{{#people}}{{name}},{{/people}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, "John,Jane,", out.String())
+
+	err = renderer.RenderHTML(strings.NewReader(`<sql src="duckdb" id="go">SELECT * FROM read_text('go.mod')</sql>`), &out)
+	assert.EqualError(t, err, `[1:27] query not allowed: the sandbox does not allow reading "go.mod": it is outside of the served directory`)
+
+	renderer = NewRenderer()
+	renderer.Root = "testdata"
+	renderer.Policies = map[string]*Policy{"duckdb://./testdata/people.duckdb": {ReadOnly: true, Sandbox: true}}
+	quoted := `<sql src="duckdb://./testdata/people.duckdb" id="people">SELECT name FROM "people" ORDER BY id</sql>{{#people}}{{name}},{{/people}}`
+	out.Reset()
+	err = renderer.RenderHTML(strings.NewReader(quoted), &out)
+	require.NoError(t, err, "quoted table names are not files")
+	assert.Equal(t, "Jane,John,", out.String())
+
+	renderer = NewRenderer()
+	renderer.Policies = map[string]*Policy{"duckdb": {Settings: map[string]string{"enable_external_access": "false"}}}
+	err = renderer.RenderHTML(strings.NewReader(src), &out)
+	assert.EqualError(t, err, "[1:31] executing query: Permission Error: Scanning CSV files is disabled through configuration")
+}
+
+func TestDuckDbRelativePaths(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "reports"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "reports", "sales.csv"), []byte("region,total\nnorth,10\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "reports", "sales.html"),
+		[]byte(`<sql src="duckdb" id="sales">SELECT * FROM 'sales.csv'</sql>{{#sales}}{{region}}={{total}}{{/sales}}`), 0o644))
+
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/reports/sales.html", nil))
+	assert.Equal(t, "north=10", w.Body.String())
+
+	renderer := NewRenderer()
+	renderer.Root, renderer.Dir = root, filepath.Join(root, "reports")
+	var out bytes.Buffer
+	err := renderer.RenderHTML(strings.NewReader(`<sql src="duckdb" id="x">SELECT * FROM read_text('../../etc/passwd')</sql>`), &out)
+	assert.EqualError(t, err, fmt.Sprintf(`[1:26] path "../../etc/passwd" is outside of the data directory %s: `+
+		`relative paths in queries are resolved against %s`, root, renderer.Dir))
+}
+
+func TestDuckDbSession(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "orders.db")
+	db := &DuckDB{}
+	require.NoError(t, db.OpenConnection(parseUrl("duckdb://"+dbFile)))
+	_, err := db.Query(context.Background(), "CREATE TABLE orders AS SELECT * FROM (VALUES ('acme', 'tea'), ('globex', 'cake')) t(tenant, item)", QueryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	src := "duckdb://" + dbFile
+	h := &Handler{
+		Auth: &Auth{Authenticators: []Authenticator{&ProxyAuth{UserHeader: "X-User", TenantHeader: "X-Org", Trusted: []string{"192.0.2.0/24"}}}},
+		Policies: map[string]*Policy{src: {
+			Setup: []string{"CREATE TEMP VIEW my_orders AS SELECT * FROM orders WHERE tenant = :tenant_id"},
+		}},
+		fileserver: &bufHandler{resp: []byte(`<sql src="` + src + `" id="orders">SELECT item FROM my_orders</sql>` +
+			`<sql src="` + src + `" id="n">SELECT count(*) AS n FROM my_orders</sql>{{#orders}}{{item}}{{/orders}} {{n[0].n}}`)},
+	}
+	get := func(org string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User", "alice")
+		req.Header.Set("X-Org", org)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	assert.Equal(t, "tea 1", get("acme"))
+	assert.Equal(t, "cake 1", get("globex"))
+	assert.Equal(t, " 0", get("o'hare"))
+}
+
+func TestDuckDbCheck(t *testing.T) {
+	root := testSite(t, map[string]string{
+		"sales.csv": "region,total\nnorth,10\n",
+		"ok.html": `<sql src="duckdb" id="sales">SELECT region, sum(total) AS total FROM 'sales.csv' WHERE region <> :user_id GROUP BY region</sql>
+{{#sales}}{{region}}={{total}}{{/sales}}`,
+		"bad.html": `<sql src="duckdb" id="sales">SELECT regoin FROM 'sales.csv'</sql>
+<sql src="duckdb" id="totals">SELECT total FROM 'sales.csv'</sql>{{#totals}}{{totl}}{{/totals}}
+<sql src="duckdb" id="missing">SELECT * FROM 'missing.csv'</sql>`,
+	})
+	h := RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	h.Policies = map[string]*Policy{"duckdb": {ReadOnly: true, Sandbox: true}}
+
+	diags, err := h.Check()
+	require.NoError(t, err)
+	require.Len(t, diags, 3)
+	for _, d := range diags {
+		assert.Equal(t, filepath.Join(root, "bad.html"), d.File, "ok.html has no problems")
+	}
+	assert.Contains(t, diags[0].String(), `bad.html:1:30: error: checking query: Binder Error: Referenced column "regoin" not found`)
+	assert.Contains(t, diags[1].String(), `bad.html:2:77: error: unknown variable "totl" (did you mean "total"?)`)
+	assert.Contains(t, diags[2].String(), `bad.html:3:32: error: checking query: IO Error: No files found that match the pattern`)
+}
+
+func TestDuckDbScaffold(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Scaffold(dir))
+	site := filepath.Join(dir, "site")
+	h := RenderAll(http.FileServer(http.Dir(site)))
+	h.Root, h.DataDir = site, filepath.Join(dir, "data")
+	h.Policies = map[string]*Policy{"duckdb": {ReadOnly: true, Sandbox: true}}
+
+	diags, err := h.Check()
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	out := filepath.Join(t.TempDir(), "dist")
+	require.NoError(t, h.Build(out))
+	index, err := os.ReadFile(filepath.Join(out, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, strings.Count(string(index), `<a href="/products/`))
+	assert.Contains(t, string(index), "Page 1 of 3")
+	assert.Contains(t, string(index), `<link rel="stylesheet" href="/style.css">`)
+
+	desk, err := os.ReadFile(filepath.Join(out, "products", "oak-desk.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(desk), "<h1>Oak Desk</h1>")
+	assert.Contains(t, string(desk), "420.00")
+	assert.Contains(t, string(desk), "Only 2 left")
+	assert.FileExists(t, filepath.Join(out, "style.css"))
+	assert.NoDirExists(t, filepath.Join(out, "partials"))
+}
@@ -0,0 +1,68 @@
+package esqlo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultNest is the name of the list of rows in each group when an <sql> tag with group-by has no nest attribute.
+const DefaultNest = "rows"
+
+// GroupRows groups the rows of a result by the values of the columns in groupBy. Each group becomes a single
+// row holding the groupBy columns and a list of the rows of the group under the name nest, which allows
+// rendering master/detail structures from a single query:
+//
+//	<sql id="restaurants" group-by="restaurant" nest="reviews">
+//	  SELECT restaurant, reviewer, stars FROM reviews ORDER BY restaurant
+//	</sql>
+//	{{#restaurants}}<h2>{{restaurant}}</h2>{{#reviews}}<p>{{reviewer}}: {{stars}}</p>{{/reviews}}{{/restaurants}}
+//
+// Groups are ordered by the first appearance of their values in the result, and rows keep their order within
+// a group. The grouped result keeps the page and truncation of res.
+func GroupRows(res *Result, groupBy []string, nest string) (*Result, error) {
+	var indices []int
+	types := []ColumnType{}
+	for _, col := range groupBy {
+		i := slices.Index(res.Columns, col)
+		if i < 0 {
+			return nil, fmt.Errorf("group-by column %q not found in result columns %v", col, res.Columns)
+		}
+		indices = append(indices, i)
+		types = append(types, res.ColumnTypes[i])
+	}
+	types = append(types, ColumnType{Name: nest})
+
+	var grouped [][]any
+	groups := make(map[string][]any)
+	for r, row := range res.Values {
+		var group []any
+		for _, i := range indices {
+			group = append(group, row[i])
+		}
+		key := rowKey(group)
+
+		if existing, ok := groups[key]; ok {
+			group = existing
+		} else {
+			group = append(group, []any{})
+			groups[key] = group
+			grouped = append(grouped, group)
+		}
+		group[len(indices)] = append(group[len(indices)].([]any), res.Rows[r])
+	}
+	res2 := NewResult(append(slices.Clip(groupBy), nest), types, grouped)
+	res2.Page, res2.Truncated = res.Page, res.Truncated
+	return res2, nil
+}
+
+// parseColumnList parses a comma-separated list of column names from an attribute.
+func parseColumnList(s string) []string {
+	var cols []string
+	for _, col := range strings.Split(s, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
@@ -0,0 +1,56 @@
+package esqlo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var reviewsDb = &MemDB{
+	Tables: map[string]*MemTable{
+		"reviews": {
+			Columns: []string{"restaurant", "reviewer", "stars"},
+			Rows: [][]any{
+				{"McDonalds", "John", 5},
+				{"Burger King", "Blake", 3},
+				{"McDonalds", "Jane", 1},
+			},
+		},
+	},
+}
+
+func TestGroupRows(t *testing.T) {
+	res, err := reviewsDb.Query(context.Background(), "SELECT * FROM reviews", QueryOptions{})
+	require.NoError(t, err)
+
+	grouped, err := GroupRows(res, []string{"restaurant"}, "reviews")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"restaurant", "reviews"}, grouped.Columns)
+	assert.Equal(t, []any{
+		map[string]any{"restaurant": "McDonalds", "reviews": []any{res.Rows[0], res.Rows[2]}},
+		map[string]any{"restaurant": "Burger King", "reviews": []any{res.Rows[1]}},
+	}, grouped.Rows)
+
+	_, err = GroupRows(res, []string{"city"}, "reviews")
+	assert.EqualError(t, err, `group-by column "city" not found in result columns [restaurant reviewer stars]`)
+}
+
+func TestRenderGroupBy(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = reviewsDb
+
+	var out bytes.Buffer
+	src := `<sql id="restaurants" group-by="restaurant" nest="reviews">SELECT * FROM reviews</sql>
+{{#restaurants}}<h2>{{restaurant}}</h2>{{#reviews}}<p>{{reviewer}}: {{stars}}</p>{{/reviews}}
+{{/restaurants}}<sql id="r" group-by="restaurant">SELECT restaurant FROM reviews</sql>{{#r}}{{#rows}}.{{/rows}}{{/r}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, `
+<h2>McDonalds</h2><p>John: 5</p><p>Jane: 1</p>
+<h2>Burger King</h2><p>Blake: 3</p>
+...`, out.String())
+}
@@ -3,8 +3,13 @@ package esqlo
 import (
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Handler is will wrap fileserver and render any esqlo templates returned. If a file is not html,
@@ -12,32 +17,139 @@ import (
 // as a esqlo template and rendered with the sql statements automatically resolved using the configured database connections.
 type Handler struct {
 	Databases map[string]Database
+	Strict    bool          // render every page in strict mode, see Renderer.Strict
+	Timeout   time.Duration // the default timeout of queries, see Renderer.Timeout
+
+	// Limits of the results of each query and of each page, see Renderer.MaxRows.
+	MaxRows      int
+	MaxBytes     int64
+	MaxPageRows  int
+	MaxPageBytes int64
+
+	Auth     *Auth              // if set, requests must be authenticated, see Auth
+	Policies map[string]*Policy // restrictions of the queries of sources, see Renderer.Policies
+	Root     string             // the served directory, see Renderer.Root
+	DataDir  string             // the directory of the files of queries, see Renderer.Dir, the directory of each template if empty
 
 	fileserver http.Handler // normal fileserver
 }
 
-func RenderAll(handler http.Handler) http.Handler {
+func RenderAll(handler http.Handler) *Handler {
 	return &Handler{
 		fileserver: handler,
 	}
 }
 
 func (d *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var user *User
+	if d.Auth != nil {
+		var ok bool
+		if user, ok = d.Auth.check(w, r); !ok {
+			return
+		}
+	}
+
 	fpath := path.Clean(r.URL.Path)
-	if strings.HasSuffix(fpath, ".html") || fpath == "/" {
-		pr, pw := io.Pipe()
-		defer pr.Close()
-		go func() {
-			d.fileserver.ServeHTTP(&respWrapper{Writer: pw, w: w}, r)
-			pw.Close()
-		}()
-		render := NewRenderer()
-		render.Databases = d.Databases
-		w.Header().Set("Content-Type", "text/html")
-		render.RenderHTML(pr, w)
-	} else {
+	if !strings.HasSuffix(fpath, ".html") && fpath != "/" {
+		if d.hidesData(fpath) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
 		d.fileserver.ServeHTTP(w, r)
+		return
+	}
+
+	if isDynamic(fpath) {
+		// templates of dynamic routes are only rendered for the pages of their routes, never as themselves
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if tmpl, params, ok := d.route(fpath); ok {
+		f, err := os.Open(filepath.Join(d.Root, filepath.FromSlash(tmpl)))
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "text/html")
+		d.Renderer(r.URL, "/"+tmpl, user, params).RenderHTMLContext(r.Context(), f, w)
+		return
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		d.fileserver.ServeHTTP(&respWrapper{Writer: pw, w: w}, r)
+		pw.Close()
+	}()
+	w.Header().Set("Content-Type", "text/html")
+	d.Renderer(r.URL, fpath, user, nil).RenderHTMLContext(r.Context(), pr, w)
+}
+
+// dataExts are the extensions of the data files that are not served when sources have setup statements.
+var dataExts = []string{".csv", ".tsv", ".json", ".ndjson", ".jsonl", ".parquet", ".duckdb", ".db", ".wal"}
+
+// hidesData reports whether the data file at the path must not be served: if the policy of any source has setup
+// statements to restrict what pages see, e.g. the rows of a tenant, downloading the files would bypass them.
+func (d *Handler) hidesData(p string) bool {
+	if !slices.Contains(dataExts, strings.ToLower(path.Ext(p))) {
+		return false
+	}
+	for _, policy := range d.Policies {
+		if policy != nil && len(policy.Setup) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns the dynamic route of Root that serves the path of a page that does not exist, see matchRoute.
+func (d *Handler) route(fpath string) (string, map[string]string, bool) {
+	if d.Root == "" || fpath == "/" {
+		return "", nil, false
+	}
+	if _, err := os.Stat(filepath.Join(d.Root, filepath.FromSlash(fpath))); err == nil {
+		return "", nil, false
+	}
+	tmpl, params, ok := matchRoute(d.Root, fpath)
+	if !ok || !isDynamic(tmpl) {
+		return "", nil, false
+	}
+	return tmpl, params, true
+}
+
+// Renderer returns a renderer of the template at the path tmpl of Root for the user, with the parameters of its
+// dynamic route, set up like the renderers of the pages that the handler serves.
+func (d *Handler) Renderer(u *url.URL, tmpl string, user *User, params map[string]string) *Renderer {
+	render := NewRenderer()
+	render.Databases = d.Databases
+	render.Strict = d.Strict
+	render.URL = u
+	render.Timeout = d.Timeout
+	render.MaxRows, render.MaxBytes = d.MaxRows, d.MaxBytes
+	render.MaxPageRows, render.MaxPageBytes = d.MaxPageRows, d.MaxPageBytes
+	render.Policies = d.Policies
+	render.Partials = d.Root
+	render.User = user
+	render.Params = map[string]any{"user_id": nil, "tenant_id": nil}
+	if user != nil {
+		render.Params["user_id"] = user.ID
+		if user.Tenant != "" {
+			render.Params["tenant_id"] = user.Tenant
+		}
+	}
+	for name, value := range params {
+		if _, ok := render.Params[name]; !ok { // a route cannot pretend to be another user
+			render.Params[name] = value
+		}
+	}
+	switch {
+	case d.DataDir != "":
+		render.Root, render.Dir = d.DataDir, d.DataDir
+	case d.Root != "":
+		render.Root, render.Dir = d.Root, filepath.Join(d.Root, filepath.FromSlash(path.Dir(tmpl)))
 	}
+	return render
 }
 
 // respWrapper takes a straem of bytes representing an html file and returns
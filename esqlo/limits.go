@@ -0,0 +1,79 @@
+package esqlo
+
+import (
+	"reflect"
+)
+
+// QueryOptions are the arguments of a query and the limits of its result. Databases stop reading rows once a
+// limit is reached and mark the result as Truncated, so a careless query cannot load a whole table into memory.
+type QueryOptions struct {
+	Args     []any // the values of the ? placeholders of the query, see Renderer.Params
+	MaxRows  int   // the maximum number of rows, 0 for no limit
+	MaxBytes int64 // the maximum approximate size of all values in bytes, 0 for no limit
+}
+
+// rowLimiter counts the rows of a result against the limits of QueryOptions.
+type rowLimiter struct {
+	opts  QueryOptions
+	rows  int
+	bytes int64
+}
+
+// add reports whether a row with values fits within the limits and counts it if it does.
+func (l *rowLimiter) add(values []any) bool {
+	if l.opts.MaxRows > 0 && l.rows >= l.opts.MaxRows {
+		return false
+	}
+	size := rowSize(values)
+	if l.opts.MaxBytes > 0 && l.bytes+size > l.opts.MaxBytes {
+		return false
+	}
+	l.rows++
+	l.bytes += size
+	return true
+}
+
+// limitRows returns the rows of values that fit within the limits of opts, and whether rows were left out.
+func limitRows(values [][]any, opts QueryOptions) ([][]any, bool) {
+	l := rowLimiter{opts: opts}
+	for i, row := range values {
+		if !l.add(row) {
+			return values[:i], true
+		}
+	}
+	return values, false
+}
+
+// rowSize returns the approximate size of the values of a row in memory.
+func rowSize(values []any) int64 {
+	var size int64
+	for _, v := range values {
+		size += valueSize(v)
+	}
+	return size
+}
+
+// valueSize returns the approximate size of a normalized value in memory, see Normalize.
+func valueSize(v any) int64 {
+	const word = 16 // the size of an interface value
+	switch v := v.(type) {
+	case nil, bool, int64, float64, Time:
+		return word
+	case string:
+		return word + int64(len(v))
+	case Decimal:
+		if v.Value == nil {
+			return word
+		}
+		return word + int64(len(v.Value.Bits())*8)
+	case []any:
+		return word + rowSize(v)
+	case map[string]any:
+		size := int64(word)
+		for k, v := range v {
+			size += word + int64(len(k)) + valueSize(v)
+		}
+		return size
+	}
+	return word + int64(reflect.TypeOf(v).Size())
+}
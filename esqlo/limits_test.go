@@ -0,0 +1,75 @@
+package esqlo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitRows(t *testing.T) {
+	values := [][]any{{"a"}, {"b"}, {"c"}}
+	rows, truncated := limitRows(values, QueryOptions{})
+	assert.Equal(t, values, rows)
+	assert.False(t, truncated)
+
+	rows, truncated = limitRows(values, QueryOptions{MaxRows: 2})
+	assert.Equal(t, values[:2], rows)
+	assert.True(t, truncated)
+
+	rows, truncated = limitRows(values, QueryOptions{MaxBytes: 2 * valueSize("a")})
+	assert.Equal(t, values[:2], rows)
+	assert.True(t, truncated)
+
+	res, err := itemsDb.Query(context.Background(), "SELECT id FROM items", QueryOptions{MaxRows: 3})
+	require.NoError(t, err)
+	assert.Len(t, res.Rows, 3)
+	assert.True(t, res.Truncated)
+}
+
+func TestValueSize(t *testing.T) {
+	assert.Equal(t, int64(16), valueSize(nil))
+	assert.Equal(t, int64(16), valueSize(int64(1)))
+	assert.Equal(t, int64(21), valueSize("hello"))
+	assert.Equal(t, int64(16+16+17), valueSize([]any{nil, "x"}))
+	assert.Equal(t, int64(16+16+1+16), valueSize(map[string]any{"k": 1.5}))
+}
+
+func TestRenderLimits(t *testing.T) {
+	render := func(renderer *Renderer, src string) string {
+		t.Helper()
+		renderer.Databases[ImplicitDb] = itemsDb
+		var out bytes.Buffer
+		err := renderer.RenderHTML(strings.NewReader(src), &out)
+		require.NoError(t, err)
+		return out.String()
+	}
+
+	renderer := NewRenderer()
+	out := render(renderer, `<sql id="items" max-rows="2">SELECT id FROM items</sql>{{#items}}{{id}}{{/items}}{{#items.$truncated}}...{{/items.$truncated}}`)
+	assert.Equal(t, "12...", out)
+	assert.Empty(t, renderer.Warnings, "limits of the tag itself are intended")
+
+	renderer = NewRenderer()
+	renderer.MaxRows = 3
+	out = render(renderer, `<sql id="items" max-rows="4">SELECT id FROM items</sql>{{#items}}{{id}}{{/items}}{{#items.$truncated}}...{{/items.$truncated}}`)
+	assert.Equal(t, "123...", out)
+	require.Len(t, renderer.Warnings, 1)
+	assert.EqualError(t, renderer.Warnings[0], "[1:30] result truncated to 3 rows by the row and size limits")
+
+	renderer = NewRenderer()
+	renderer.MaxPageRows = 4
+	out = render(renderer, `<sql id="a">SELECT id FROM items LIMIT 3</sql><sql id="b">SELECT id FROM items</sql>{{#a}}{{id}}{{/a}} {{#b}}{{id}}{{/b}} {{b.$truncated}}`)
+	assert.Equal(t, "123 1 true", out)
+	require.Len(t, renderer.Warnings, 1)
+
+	renderer = NewRenderer()
+	renderer.Databases[ImplicitDb] = itemsDb
+	renderer.MaxPageRows = 1
+	var buf bytes.Buffer
+	err := renderer.RenderHTML(strings.NewReader(`<sql id="a">SELECT id FROM items LIMIT 1</sql><sql id="b">SELECT id FROM items</sql>`), &buf)
+	assert.EqualError(t, err, "[1:59] skipping query: the page reached its limit of 1 rows")
+}
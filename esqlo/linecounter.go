@@ -47,6 +47,19 @@ func (l *LineCounter) LineCol(offset int) (line, col int) {
 	return
 }
 
+// Offset is the inverse of LineCol: it returns the byte offset of the 1-based line and column. Lines beyond the
+// last recorded line return the offset after the input read so far.
+func (l *LineCounter) Offset(line, col int) int {
+	switch {
+	case line <= 1:
+		return col - 1
+	case line-2 >= len(l.lineoffs):
+		return l.offset
+	default:
+		return l.lineoffs[line-2] + 1 + col - 1
+	}
+}
+
 func (l *LineCounter) scan(p []byte) {
 	for i := 0; i < len(p); i++ {
 		if p[i] == '\n' {
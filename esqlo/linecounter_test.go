@@ -2,6 +2,7 @@ package esqlo
 
 import (
 	"bytes"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,15 @@ func TestLineCounterHTML(t *testing.T) {
 	assert.Equal(t, 5, line)
 	assert.Equal(t, 9, col)
 }
+
+func TestLineCounterOffset(t *testing.T) {
+	lc := NewLineCounter(bytes.NewReader([]byte("ab\ncd\n\nef")))
+	_, err := io.ReadAll(lc)
+	assert.NoError(t, err)
+
+	for _, offset := range []int{0, 1, 3, 4, 6, 7, 8, 9} {
+		line, col := lc.LineCol(offset)
+		assert.Equal(t, offset, lc.Offset(line, col), "offset %d at %d:%d", offset, line, col)
+	}
+	assert.Equal(t, 9, lc.Offset(8, 1), "lines beyond the input are at its end")
+}
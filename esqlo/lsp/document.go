@@ -0,0 +1,181 @@
+package lsp
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/masp/esqlo/esqlo"
+)
+
+// document is an open template with the sql tags that were loaded when it was last checked.
+type document struct {
+	text string
+	lc   *esqlo.LineCounter
+	tags []*esqlo.SqlTag
+}
+
+func newDocument(text string) *document {
+	lc := esqlo.NewLineCounter(strings.NewReader(text))
+	io.Copy(io.Discard, lc) // a strings.Reader never fails
+	return &document{text: text, lc: lc}
+}
+
+// position converts a byte offset into a position of LSP.
+func (d *document) position(offset int) position {
+	offset = min(max(offset, 0), len(d.text))
+	line, col := d.lc.LineCol(offset)
+	start := offset - (col - 1)
+	return position{Line: line - 1, Character: utf16Len(d.text[start:offset])}
+}
+
+// offset converts a position of LSP into a byte offset.
+func (d *document) offset(p position) int {
+	offset := min(d.lc.Offset(p.Line+1, 1), len(d.text))
+	for units := 0; offset < len(d.text) && units < p.Character; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += runeLen(r)
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) textRange(start, end int) textRange {
+	return textRange{Start: d.position(start), End: d.position(end)}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeLen(r)
+	}
+	return n
+}
+
+// runeLen returns the number of UTF-16 code units of r.
+func runeLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// wordEnd returns the end of the word at offset, to underline the word that a diagnostic refers to.
+func (d *document) wordEnd(offset int) int {
+	end := offset
+	for end < len(d.text) && !strings.ContainsRune(" \t\r\n>}", rune(d.text[end])) {
+		end++
+	}
+	if end == offset && end < len(d.text) {
+		end++
+	}
+	return end
+}
+
+// nameAt returns the name in the mustache tag {{...}} at offset, e.g. reviews.$page in {{#reviews.$page}}, and
+// its offset. The name ends at the end of its part at offset, so for reviews.$page it is reviews if offset is
+// in reviews.
+func (d *document) nameAt(offset int) (string, int, bool) {
+	open := strings.LastIndex(d.text[:offset], "{{")
+	if open < 0 || strings.Contains(d.text[open:offset], "}}") {
+		return "", 0, false
+	}
+	start := offset
+	for start > open+2 && isNameChar(d.text[start-1]) {
+		start--
+	}
+	end := offset
+	for end < len(d.text) && isNameChar(d.text[end]) && d.text[end] != '.' {
+		end++
+	}
+	name := d.text[start:end]
+	for strings.HasPrefix(name, "../") {
+		name, start = name[3:], start+3
+	}
+	if strings.HasPrefix(name, "/") { // a closing tag, e.g. {{/reviews}}
+		name, start = name[1:], start+1
+	}
+	return name, start, name != ""
+}
+
+// prefixAt returns the part of the name in a mustache tag before offset, for completion.
+func (d *document) prefixAt(offset int) (string, bool) {
+	open := strings.LastIndex(d.text[:offset], "{{")
+	if open < 0 || strings.Contains(d.text[open:offset], "}}") {
+		return "", false
+	}
+	start := offset
+	for start > open+2 && isNameChar(d.text[start-1]) {
+		start--
+	}
+	return strings.TrimLeft(d.text[start:offset], "./"), true
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == '.' || c == '[' || c == ']' || c == '/' ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+var sectionTag = regexp.MustCompile(`\{\{\s*([#^/])\s*([^\s}]+)\s*\}\}`)
+
+// sections returns the names of the sections that enclose offset, innermost first.
+func (d *document) sections(offset int) []string {
+	var stack []string
+	for _, m := range sectionTag.FindAllStringSubmatch(d.text[:offset], -1) {
+		if m[1] != "/" {
+			stack = append(stack, m[2])
+		} else if n := len(stack); n > 0 && stack[n-1] == m[2] {
+			stack = stack[:n-1]
+		}
+	}
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+// table returns the sql tag with the id name, ignoring indices like reviews[0].
+func (d *document) table(name string) *esqlo.SqlTag {
+	name, _, _ = strings.Cut(name, "[")
+	for _, tag := range d.tags {
+		if tag.TableName == name {
+			return tag
+		}
+	}
+	return nil
+}
+
+// column returns the sql tag and the type of the column name, preferring the tables of the sections that
+// enclose offset.
+func (d *document) column(name string, offset int) (*esqlo.SqlTag, *esqlo.ColumnType) {
+	var tags []*esqlo.SqlTag
+	for _, section := range d.sections(offset) {
+		table, _, _ := strings.Cut(section, ".")
+		if tag := d.table(table); tag != nil {
+			tags = append(tags, tag)
+		}
+	}
+	tags = append(tags, d.tags...)
+	for _, tag := range tags {
+		if t := columnType(tag, name); t != nil {
+			return tag, t
+		}
+	}
+	return nil, nil
+}
+
+func columnType(tag *esqlo.SqlTag, name string) *esqlo.ColumnType {
+	if tag.Result == nil {
+		return nil
+	}
+	for i, col := range tag.Result.Columns {
+		if col == name && i < len(tag.Result.ColumnTypes) {
+			return &tag.Result.ColumnTypes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+
+	"go.lsp.dev/uri"
+)
+
+// The subset of the Language Server Protocol that the server implements, see
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/.
+
+// message is a JSON-RPC 2.0 request, a notification if it has no ID, or a response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes of JSON-RPC.
+const (
+	codeParseError     = -32700
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+)
+
+// conn reads and writes messages with a Content-Length header, as the base protocol of LSP does on stdio.
+type conn struct {
+	r  *textproto.Reader
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+func (c *conn) read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, &responseError{Code: codeParseError, Message: err.Error()}
+	}
+	return &msg, nil
+}
+
+func (c *conn) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+func (e *responseError) Error() string { return e.Message }
+
+// position is a 0-based line and a character offset in UTF-16 code units.
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   uri.URI   `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+// Severities of diagnostics.
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+type publishDiagnosticsParams struct {
+	URI         uri.URI      `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+type textDocumentIdentifier struct {
+	URI uri.URI `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  uri.URI `json:"uri"`
+		Text string  `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type completionItem struct {
+	Label    string `json:"label"`
+	Kind     int    `json:"kind,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	SortText string `json:"sortText,omitempty"`
+}
+
+// Kinds of completion items.
+const (
+	kindField    = 5
+	kindVariable = 6
+	kindProperty = 10
+	kindStruct   = 22
+)
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *textRange    `json:"range,omitempty"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
@@ -0,0 +1,312 @@
+// Package lsp implements a language server of esqlo templates, so editors can show the problems of templates
+// while they are edited, complete the names of tables and columns inside {{ }}, go to the <sql> tag of a table
+// and show the columns of tables and their types.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/masp/esqlo/esqlo"
+	"github.com/rs/zerolog/log"
+	"go.lsp.dev/uri"
+)
+
+// Server is a language server of the templates of a Handler. Templates are checked like with Handler.Check
+// every time they change.
+type Server struct {
+	Handler *esqlo.Handler
+
+	conn *conn
+	docs map[uri.URI]*document
+}
+
+// Serve reads requests from r and writes responses to w until the client exits or r ends.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+	s.docs = make(map[uri.URI]*document)
+	for {
+		msg, err := s.conn.read()
+		var rerr *responseError
+		if errors.As(err, &rerr) {
+			s.conn.write(&message{ID: json.RawMessage("null"), Error: rerr})
+			continue
+		} else if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				log.Warn().Msgf("%s: %v", msg.Method, err)
+			}
+			continue // notifications have no response
+		}
+		resp := &message{ID: msg.ID}
+		if errors.As(err, &rerr) {
+			resp.Error = rerr
+		} else if err != nil {
+			resp.Error = &responseError{Code: codeInvalidParams, Message: err.Error()}
+		} else if resp.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+		if err := s.conn.write(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // the client sends the full text of changed documents
+				"completionProvider": map[string]any{"triggerCharacters": []string{"{", "."}},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+			},
+			"serverInfo": map[string]any{"name": "esqlo"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			return nil, s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, []diagnostic{})
+	case "textDocument/completion", "textDocument/definition", "textDocument/hover":
+		var params positionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, fmt.Errorf("unknown document %s", params.TextDocument.URI)
+		}
+		offset := doc.offset(params.Position)
+		switch msg.Method {
+		case "textDocument/completion":
+			return complete(doc, offset), nil
+		case "textDocument/definition":
+			return define(doc, params.TextDocument.URI, offset), nil
+		default:
+			return describe(doc, offset), nil
+		}
+	}
+	if msg.ID != nil {
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	return nil, nil // e.g. initialized and $/ notifications
+}
+
+// update checks the new text of a document and publishes its diagnostics.
+func (s *Server) update(u uri.URI, text string) error {
+	doc := newDocument(text)
+	s.docs[u] = doc
+
+	tmpl, ok := s.template(u)
+	if !ok {
+		return s.publish(u, []diagnostic{}) // not a template of the served directory
+	}
+	diags, tags := s.Handler.InspectTemplate(tmpl, strings.NewReader(text))
+	doc.tags = tags
+	lspDiags := make([]diagnostic, 0, len(diags))
+	for _, d := range diags {
+		start := doc.lc.Offset(d.Line, d.Col)
+		severity := severityError
+		if d.Warning {
+			severity = severityWarning
+		}
+		lspDiags = append(lspDiags, diagnostic{
+			Range:    doc.textRange(start, doc.wordEnd(start)),
+			Severity: severity,
+			Source:   "esqlo",
+			Message:  d.Msg,
+		})
+	}
+	return s.publish(u, lspDiags)
+}
+
+func (s *Server) publish(u uri.URI, diags []diagnostic) error {
+	params, err := json.Marshal(publishDiagnosticsParams{URI: u, Diagnostics: diags})
+	if err != nil {
+		return err
+	}
+	return s.conn.write(&message{Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// template returns the path of the template of a document relative to the Root of the Handler.
+func (s *Server) template(u uri.URI) (string, bool) {
+	if !strings.HasPrefix(string(u), uri.FileScheme+"://") || !strings.HasSuffix(string(u), ".html") {
+		return "", false
+	}
+	root, err := filepath.Abs(s.Handler.Root)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, u.Filename())
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// complete returns the tables, or the columns of a table after its name and a dot, in a mustache tag.
+func complete(doc *document, offset int) []completionItem {
+	prefix, ok := doc.prefixAt(offset)
+	if !ok {
+		return []completionItem{}
+	}
+	items := []completionItem{}
+	if i := strings.LastIndexByte(prefix, '.'); i >= 0 {
+		base := prefix[:i]
+		if base == "user" {
+			for _, field := range []string{"id", "name", "roles", "tenant"} {
+				items = append(items, completionItem{Label: field, Kind: kindProperty, Detail: "user"})
+			}
+		} else if tag := doc.table(base); tag != nil && !strings.Contains(base, ".") {
+			items = append(items, columns(tag, "0")...)
+			meta := []string{"$columns", "$rows", "$truncated"}
+			if tag.Paginate > 0 {
+				meta = append(meta, "$page", "$page_size", "$total", "$total_pages", "$has_next", "$has_prev", "$next_url", "$prev_url")
+			}
+			for _, m := range meta {
+				items = append(items, completionItem{Label: m, Kind: kindProperty, Detail: tag.TableName, SortText: "1" + m})
+			}
+		}
+		return items
+	}
+
+	seen := make(map[string]bool)
+	for _, section := range doc.sections(offset) { // the columns of the current rows first
+		if tag := doc.table(strings.Split(section, ".")[0]); tag != nil && !seen[tag.TableName] {
+			seen[tag.TableName] = true
+			items = append(items, columns(tag, "0")...)
+		}
+	}
+	for _, tag := range doc.tags {
+		items = append(items, completionItem{Label: tag.TableName, Kind: kindStruct, Detail: "table from " + tag.Src, SortText: "1" + tag.TableName})
+	}
+	for _, tag := range doc.tags {
+		if !seen[tag.TableName] {
+			items = append(items, columns(tag, "2")...)
+		}
+	}
+	items = append(items,
+		completionItem{Label: "user", Kind: kindVariable, Detail: "the logged in user", SortText: "3user"},
+		completionItem{Label: "params", Kind: kindVariable, Detail: "the parameters of the page", SortText: "3params"})
+
+	unique := items[:0]
+	labels := make(map[string]bool)
+	for _, item := range items {
+		if !labels[item.Label] {
+			labels[item.Label] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+// columns returns the completion items of the columns of a tag, sorted after the items of lower groups.
+func columns(tag *esqlo.SqlTag, group string) []completionItem {
+	var items []completionItem
+	if tag.Result == nil {
+		return nil
+	}
+	for i, col := range tag.Result.Columns {
+		detail := tag.TableName
+		if i < len(tag.Result.ColumnTypes) && tag.Result.ColumnTypes[i].Type != "" {
+			detail += ": " + tag.Result.ColumnTypes[i].Type
+		}
+		items = append(items, completionItem{Label: col, Kind: kindField, Detail: detail, SortText: fmt.Sprintf("%s%03d", group, i)})
+	}
+	return items
+}
+
+// target returns the sql tag of the table or column at offset, and the column if it is one.
+func target(doc *document, offset int) (*esqlo.SqlTag, *esqlo.ColumnType, int, int) {
+	name, start, ok := doc.nameAt(offset)
+	if !ok {
+		return nil, nil, 0, 0
+	}
+	end := start + len(name)
+	parts := strings.Split(name, ".")
+	if len(parts) == 1 {
+		if tag := doc.table(name); tag != nil {
+			return tag, nil, start, end
+		}
+		tag, col := doc.column(name, offset)
+		return tag, col, start, end
+	}
+	last := parts[len(parts)-1]
+	if tag := doc.table(parts[0]); tag != nil && len(parts) == 2 {
+		if col := columnType(tag, last); col != nil {
+			return tag, col, end - len(last), end
+		}
+	}
+	return nil, nil, 0, 0
+}
+
+// define returns the location of the sql tag of the table or column at offset.
+func define(doc *document, u uri.URI, offset int) []location {
+	tag, _, _, _ := target(doc, offset)
+	if tag == nil {
+		return []location{}
+	}
+	return []location{{URI: u, Range: doc.textRange(tag.Start, tag.Offset)}}
+}
+
+// describe returns the columns and their types of the table at offset, or the type of the column at offset.
+func describe(doc *document, offset int) *hover {
+	tag, col, start, end := target(doc, offset)
+	if tag == nil {
+		return nil
+	}
+	var b strings.Builder
+	if col != nil {
+		fmt.Fprintf(&b, "**%s** `%s`\n\ncolumn of **%s**", col.Name, typeName(*col), tag.TableName)
+	} else {
+		fmt.Fprintf(&b, "**%s** from `%s`\n\n| column | type |\n|---|---|\n", tag.TableName, tag.Src)
+		if tag.Result != nil {
+			for _, t := range tag.Result.ColumnTypes {
+				fmt.Fprintf(&b, "| %s | %s |\n", t.Name, typeName(t))
+			}
+		}
+	}
+	r := doc.textRange(start, end)
+	return &hover{Contents: markupContent{Kind: "markdown", Value: b.String()}, Range: &r}
+}
+
+func typeName(t esqlo.ColumnType) string {
+	if t.Type == "" {
+		return "unknown type"
+	}
+	return t.Type
+}
@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/masp/esqlo/esqlo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/uri"
+)
+
+// client talks to a Server over pipes like an editor.
+type client struct {
+	t      *testing.T
+	conn   *conn
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T, h *esqlo.Handler) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, conn: newConn(clientIn, clientOut), done: make(chan error, 1)}
+	go func() {
+		c.done <- (&Server{Handler: h}).Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	return c
+}
+
+func (c *client) notify(method string, params any) {
+	b, err := json.Marshal(params)
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.conn.write(&message{Method: method, Params: b}))
+}
+
+// call sends a request and returns its response, skipping notifications of the server.
+func (c *client) call(method string, params any, result any) *responseError {
+	c.nextID++
+	id := json.RawMessage(strings.TrimSpace(string(must(json.Marshal(c.nextID)))))
+	b, err := json.Marshal(params)
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.conn.write(&message{ID: id, Method: method, Params: b}))
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			continue
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		require.NoError(c.t, json.Unmarshal(msg.Result, result))
+		return nil
+	}
+}
+
+func (c *client) read() *message {
+	msg, err := c.conn.read()
+	require.NoError(c.t, err)
+	return msg
+}
+
+// diagnostics waits for the next diagnostics that the server publishes.
+func (c *client) diagnostics() publishDiagnosticsParams {
+	for {
+		msg := c.read()
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			require.NoError(c.t, json.Unmarshal(msg.Params, &params))
+			return params
+		}
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+const page = `<sql id="reviews">SELECT restaurant, stars FROM reviews</sql>
+{{#reviews}}{{restaurant}} {{stars}}{{/reviews}}
+{{reviews.$page}} {{strs}}`
+
+// edited is the page while a user types, with incomplete tags
+const edited = `<sql id="reviews">SELECT restaurant, stars FROM reviews</sql>
+{{#reviews}}{{restaurant}} {{}}{{/reviews}}
+{{reviews.}}`
+
+func TestServer(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte(page), 0o644))
+	h := esqlo.RenderAll(http.FileServer(http.Dir(root)))
+	h.Root = root
+	h.Databases = map[string]esqlo.Database{esqlo.ImplicitDb: &esqlo.MemDB{Tables: map[string]*esqlo.MemTable{
+		"reviews": {Columns: []string{"restaurant", "stars"}, Rows: [][]any{{"McDonalds", 5}}},
+	}}}
+	c := newClient(t, h)
+	doc := uri.File(filepath.Join(root, "index.html"))
+
+	var init map[string]any
+	require.Nil(t, c.call("initialize", map[string]any{}, &init))
+	assert.Equal(t, true, init["capabilities"].(map[string]any)["hoverProvider"])
+	c.notify("initialized", map[string]any{})
+
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": doc, "text": page}})
+	diags := c.diagnostics()
+	assert.Equal(t, doc, diags.URI)
+	require.Len(t, diags.Diagnostics, 2)
+	assert.Equal(t, `unknown variable "reviews.$page"`, diags.Diagnostics[0].Message)
+	assert.Equal(t, `unknown variable "strs" (did you mean "stars"?)`, diags.Diagnostics[1].Message)
+	assert.Equal(t, textRange{Start: position{Line: 2, Character: 18}, End: position{Line: 2, Character: 24}}, diags.Diagnostics[1].Range)
+
+	at := func(line, char int) positionParams {
+		return positionParams{TextDocument: textDocumentIdentifier{URI: doc}, Position: position{Line: line, Character: char}}
+	}
+	labels := func(items []completionItem) []string {
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": doc},
+		"contentChanges": []map[string]any{{"text": edited}},
+	})
+	c.diagnostics()
+
+	var items []completionItem
+	require.Nil(t, c.call("textDocument/completion", at(1, 29), &items))
+	assert.Equal(t, []string{"restaurant", "stars", "reviews", "user", "params"}, labels(items))
+	require.Nil(t, c.call("textDocument/completion", at(2, 10), &items))
+	assert.Equal(t, []string{"restaurant", "stars", "$columns", "$rows", "$truncated"}, labels(items))
+	require.Nil(t, c.call("textDocument/completion", at(2, 0), &items))
+	assert.Empty(t, items, "outside of {{ }}")
+
+	var locs []location
+	require.Nil(t, c.call("textDocument/definition", at(1, 5), &locs))
+	assert.Equal(t, []location{{URI: doc, Range: textRange{Start: position{0, 0}, End: position{0, 18}}}}, locs)
+	require.Nil(t, c.call("textDocument/definition", at(1, 16), &locs))
+	assert.Len(t, locs, 1, "columns go to the tag of their table")
+
+	var h1 hover
+	require.Nil(t, c.call("textDocument/hover", at(1, 4), &h1))
+	assert.Equal(t, "**reviews** from `__mem__`\n\n| column | type |\n|---|---|\n| restaurant | unknown type |\n| stars | unknown type |\n", h1.Contents.Value)
+	var h2 hover
+	require.Nil(t, c.call("textDocument/hover", at(1, 15), &h2))
+	assert.Equal(t, "**restaurant** `unknown type`\n\ncolumn of **reviews**", h2.Contents.Value)
+	assert.Equal(t, &textRange{Start: position{1, 14}, End: position{1, 24}}, h2.Range)
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": doc},
+		"contentChanges": []map[string]any{{"text": `{{stars}}`}},
+	})
+	diags = c.diagnostics()
+	assert.Equal(t, `unknown variable "stars"`, diags.Diagnostics[0].Message)
+
+	var result any
+	err := c.call("textDocument/formatting", map[string]any{}, &result)
+	require.NotNil(t, err)
+	assert.Equal(t, codeMethodNotFound, err.Code)
+
+	require.Nil(t, c.call("shutdown", nil, &result))
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
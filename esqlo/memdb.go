@@ -1,14 +1,34 @@
 package esqlo
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/xwb1989/sqlparser"
+	"github.com/xwb1989/sqlparser/dependency/querypb"
+	"github.com/xwb1989/sqlparser/dependency/sqltypes"
 )
 
+// MemDB is a database of in-memory tables. It evaluates SELECT statements with WHERE, GROUP BY with the
+// aggregates COUNT, SUM, AVG, MIN and MAX, HAVING, DISTINCT, ORDER BY, LIMIT/OFFSET and column aliases without
+// any external database, so pages and tests can work with data that is already loaded. Tables can be combined
+// with inner, left and right joins, derived tables (subqueries in FROM) and subqueries in expressions
+// (IN, EXISTS and scalar subqueries, which may refer to the columns of the enclosing query).
+//
+// Column and table names are case-insensitive.
+//
+// INSERT, UPDATE and DELETE statements modify the tables of the database. Modified tables are replaced rather
+// than changed in place, so results and copies of the database that share tables are not affected.
 type MemDB struct {
 	Tables map[string]*MemTable
+
+	mu         sync.RWMutex // guards Tables against concurrent writes
+	describing bool         // every condition is true, see Describe
 }
 
 type MemTable struct {
@@ -16,74 +36,594 @@ type MemTable struct {
 	Rows    [][]any
 }
 
+// bindArgs replaces the ? placeholders of a statement with the literals of args. The parser names the
+// placeholders :v1, :v2 and so on in order.
+func bindArgs(stmt sqlparser.Statement, args []any) (sqlparser.Statement, error) {
+	vars := make(map[string]*querypb.BindVariable, len(args))
+	for i, arg := range args {
+		switch v := Normalize(arg).(type) {
+		case bool:
+			arg = int64(0)
+			if v {
+				arg = int64(1)
+			}
+		case nil, string, int64, float64:
+			arg = v
+		default:
+			arg = fmt.Sprint(v)
+		}
+		bv, err := sqltypes.BuildBindVariable(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		vars[fmt.Sprintf("v%d", i+1)] = bv
+	}
+	query, err := sqlparser.NewParsedQuery(stmt).GenerateQuery(vars, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sqlparser.Parse(string(query))
+}
+
+// Table converts a result into a table that can be queried with MemDB.
+func (r *Result) Table() *MemTable {
+	return &MemTable{Columns: r.Columns, Rows: r.Values}
+}
+
 func (db *MemDB) OpenConnection(path *url.URL) error {
 	return nil
 }
 
-func (db *MemDB) Query(query string) (*Result, error) {
+// Query runs a query against the tables in memory. Queries are not interrupted once they started, ctx is only
+// checked before.
+func (db *MemDB) Query(ctx context.Context, query string, opts QueryOptions) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	stmt, err := sqlparser.Parse(query)
 	if err != nil {
 		return nil, err
 	}
+	if len(opts.Args) > 0 {
+		if stmt, err = bindArgs(stmt, opts.Args); err != nil {
+			return nil, err
+		}
+	}
+
+	var n int
+	switch stmt := stmt.(type) {
+	case sqlparser.SelectStatement:
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		rel, err := db.selectRows(stmt, nil)
+		if err != nil {
+			return nil, err
+		}
+		var truncated bool
+		rel.rows, truncated = limitRows(rel.rows, opts)
+		res := rel.result()
+		res.Truncated = truncated
+		return res, nil
+	case *sqlparser.Insert:
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		n, err = db.insert(stmt)
+	case *sqlparser.Update:
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		n, err = db.update(stmt)
+	case *sqlparser.Delete:
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		n, err = db.delete(stmt)
+	default:
+		return nil, fmt.Errorf("only SELECT, INSERT, UPDATE and DELETE statements are supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewResult([]string{"count"}, nil, [][]any{{int64(n)}}), nil
+}
+
+// Describe runs a query against tables with the same columns and a single row of NULLs, without looking at any
+// data. Every condition counts as true, so that every expression is evaluated once and refers to tables and
+// columns that exist.
+func (db *MemDB) Describe(ctx context.Context, query string, args []any) (*Result, error) {
+	db.mu.RLock()
+	nulls := &MemDB{Tables: make(map[string]*MemTable, len(db.Tables)), describing: true}
+	for name, table := range db.Tables {
+		nulls.Tables[name] = &MemTable{Columns: table.Columns, Rows: [][]any{make([]any, len(table.Columns))}}
+	}
+	db.mu.RUnlock()
+	res, err := nulls.Query(ctx, query, QueryOptions{Args: args})
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(res.Columns, nil, nil), nil
+}
+
+// clone returns a database with the same tables that can be modified independently.
+func (db *MemDB) clone() *MemDB {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	c := &MemDB{Tables: make(map[string]*MemTable, len(db.Tables))}
+	for name, table := range db.Tables {
+		c.Tables[name] = table
+	}
+	return c
+}
+
+// Session runs the setup statements against a copy of the tables, so a setup like
+// DELETE FROM orders WHERE tenant <> ? only hides rows from the queries of the session.
+func (db *MemDB) Session(ctx context.Context, setup []Statement) (Database, error) {
+	c := db.clone()
+	for _, stmt := range setup {
+		if _, err := c.Query(ctx, stmt.Query, QueryOptions{Args: stmt.Args}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (db *MemDB) Close() error {
+	return nil
+}
+
+// column is a column of a relation, qualified by the name or alias of the table it belongs to.
+type column struct {
+	table, name string
+}
+
+// relation is a table produced while evaluating a query.
+type relation struct {
+	cols []column
+	rows [][]any
+}
+
+func (rel *relation) result() *Result {
+	cols := []string{}
+	for _, c := range rel.cols {
+		cols = append(cols, c.name)
+	}
+	return NewResult(cols, nil, rel.rows)
+}
+
+// index returns the index of the column name, qualified by table if it is not empty. It returns -1 if there is
+// no such column.
+func (rel *relation) index(table, name string) (int, error) {
+	idx := -1
+	for i, c := range rel.cols {
+		if !strings.EqualFold(c.name, name) || table != "" && !strings.EqualFold(c.table, table) {
+			continue
+		}
+		if idx >= 0 {
+			return -1, fmt.Errorf("column %q is ambiguous", name)
+		}
+		idx = i
+	}
+	return idx, nil
+}
+
+func (db *MemDB) table(name string) (*MemTable, error) {
+	_, t, err := db.lookupTable(name)
+	return t, err
+}
+
+// lookupTable returns the table with the given name and its key in Tables.
+func (db *MemDB) lookupTable(name string) (string, *MemTable, error) {
+	if t, ok := db.Tables[name]; ok {
+		return name, t, nil
+	}
+	for n, t := range db.Tables {
+		if strings.EqualFold(n, name) {
+			return n, t, nil
+		}
+	}
+	return "", nil, fmt.Errorf("table %q not found", name)
+}
+
+// from evaluates the FROM clause of a query into a single relation. Tables separated by commas are cross joined.
+func (db *MemDB) from(exprs sqlparser.TableExprs, outer *evalCtx) (*relation, error) {
+	var rel *relation
+	for _, expr := range exprs {
+		r, err := db.tableExpr(expr, outer)
+		if err != nil {
+			return nil, err
+		}
+		if rel == nil {
+			rel = r
+		} else {
+			rel, err = db.join(rel, r, sqlparser.JoinStr, sqlparser.JoinCondition{}, outer)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rel, nil
+}
+
+func (db *MemDB) tableExpr(expr sqlparser.TableExpr, outer *evalCtx) (*relation, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AliasedTableExpr:
+		switch src := expr.Expr.(type) {
+		case sqlparser.TableName:
+			table, err := db.table(src.Name.String())
+			if err != nil {
+				return nil, err
+			}
+			alias := src.Name.String()
+			if !expr.As.IsEmpty() {
+				alias = expr.As.String()
+			}
+			rel := &relation{rows: table.Rows}
+			for _, col := range table.Columns {
+				rel.cols = append(rel.cols, column{table: alias, name: col})
+			}
+			return rel, nil
+		case *sqlparser.Subquery:
+			// derived table, e.g. SELECT * FROM (SELECT ...) AS t
+			sub, err := db.selectRows(src.Select, outer)
+			if err != nil {
+				return nil, err
+			}
+			rel := &relation{rows: sub.rows}
+			for _, col := range sub.cols {
+				rel.cols = append(rel.cols, column{table: expr.As.String(), name: col.name})
+			}
+			return rel, nil
+		}
+	case *sqlparser.ParenTableExpr:
+		return db.from(expr.Exprs, outer)
+	case *sqlparser.JoinTableExpr:
+		left, err := db.tableExpr(expr.LeftExpr, outer)
+		if err != nil {
+			return nil, err
+		}
+		right, err := db.tableExpr(expr.RightExpr, outer)
+		if err != nil {
+			return nil, err
+		}
+		return db.join(left, right, expr.Join, expr.Condition, outer)
+	}
+	return nil, fmt.Errorf("unsupported table expression %s", sqlparser.String(expr))
+}
+
+// join joins two relations with a nested loop. Inner, cross, left and right joins are supported, with
+// conditions given by ON or USING.
+func (db *MemDB) join(left, right *relation, kind string, cond sqlparser.JoinCondition, outer *evalCtx) (*relation, error) {
+	switch kind {
+	case sqlparser.JoinStr, sqlparser.StraightJoinStr, sqlparser.LeftJoinStr:
+	case sqlparser.RightJoinStr:
+		// a right join is a left join with the sides swapped, with the columns put back in order afterwards
+		swapped, err := db.join(right, left, sqlparser.LeftJoinStr, cond, outer)
+		if err != nil {
+			return nil, err
+		}
+		rel := &relation{cols: append(append([]column{}, left.cols...), right.cols...)}
+		for _, row := range swapped.rows {
+			rel.rows = append(rel.rows, append(append([]any{}, row[len(right.cols):]...), row[:len(right.cols)]...))
+		}
+		return rel, nil
+	default:
+		return nil, fmt.Errorf("unsupported join %q", kind)
+	}
+
+	// USING (a, b) is the same as ON left.a = right.a AND left.b = right.b
+	type using struct{ l, r int }
+	var usings []using
+	for _, col := range cond.Using {
+		l, err := left.index("", col.String())
+		if err != nil {
+			return nil, err
+		}
+		r, err := right.index("", col.String())
+		if err != nil {
+			return nil, err
+		}
+		if l < 0 || r < 0 {
+			return nil, fmt.Errorf("column %q in USING not found on both sides of the join", col.String())
+		}
+		usings = append(usings, using{l, r})
+	}
+
+	rel := &relation{cols: append(append([]column{}, left.cols...), right.cols...)}
+	for _, l := range left.rows {
+		matched := false
+		for _, r := range right.rows {
+			row := append(append(make([]any, 0, len(rel.cols)), l...), r...)
+			ok := true
+			for _, u := range usings {
+				if l[u.l] == nil || r[u.r] == nil || compareValues(l[u.l], r[u.r]) != 0 {
+					ok = false
+					break
+				}
+			}
+			if ok && cond.On != nil {
+				var err error
+				ctx := &evalCtx{db: db, rel: rel, row: row, outer: outer}
+				ok, err = ctx.test(cond.On)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if ok {
+				matched = true
+				rel.rows = append(rel.rows, row)
+			}
+		}
+		if !matched && kind == sqlparser.LeftJoinStr {
+			rel.rows = append(rel.rows, append(append(make([]any, 0, len(rel.cols)), l...), make([]any, len(right.cols))...))
+		}
+	}
+	return rel, nil
+}
 
-	sel, ok := stmt.(*sqlparser.Select)
-	if !ok {
-		return nil, fmt.Errorf("only SELECT statements are supported")
+// selectRows evaluates a SELECT statement. outer is the context of the enclosing query for subqueries, or nil.
+func (db *MemDB) selectRows(stmt sqlparser.SelectStatement, outer *evalCtx) (*relation, error) {
+	var sel *sqlparser.Select
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		sel = stmt
+	case *sqlparser.ParenSelect:
+		return db.selectRows(stmt.Select, outer)
+	default:
+		return nil, fmt.Errorf("unsupported statement %s", sqlparser.String(stmt))
 	}
 
-	if len(sel.From) != 1 {
-		return nil, fmt.Errorf("only single table SELECT statements are supported")
+	var src *relation
+	if len(sel.From) == 1 && sqlparser.String(sel.From[0]) == "dual" {
+		src = &relation{rows: [][]any{{}}} // SELECT without FROM
+	} else {
+		var err error
+		src, err = db.from(sel.From, outer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// WHERE
+	var rows [][]any
+	for _, row := range src.rows {
+		if sel.Where != nil {
+			ctx := &evalCtx{db: db, rel: src, row: row, outer: outer}
+			ok, err := ctx.test(sel.Where.Expr)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		rows = append(rows, row)
 	}
 
-	tableName := sqlparser.String(sel.From[0])
-	table, ok := db.Tables[tableName]
-	if !ok {
-		return nil, fmt.Errorf("table %q not found", tableName)
+	// GROUP BY, every group (or row if there is no grouping) is evaluated in its own context
+	var ctxs []*evalCtx
+	if len(sel.GroupBy) > 0 || sel.Having != nil || hasAggregate(sel.SelectExprs) {
+		groups, err := db.group(src, rows, sel.GroupBy, outer)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			ctx := &evalCtx{db: db, rel: src, group: g, grouped: true, outer: outer}
+			if len(g) > 0 {
+				ctx.row = g[0]
+			}
+			if sel.Having != nil {
+				ok, err := ctx.test(sel.Having.Expr)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			ctxs = append(ctxs, ctx)
+		}
+	} else {
+		for _, row := range rows {
+			ctxs = append(ctxs, &evalCtx{db: db, rel: src, row: row, outer: outer})
+		}
 	}
 
-	var columns []string
+	// SELECT expressions
+	out := &relation{}
+	var projections []func(ctx *evalCtx) ([]any, error)
 	for _, expr := range sel.SelectExprs {
 		switch expr := expr.(type) {
-		case *sqlparser.AliasedExpr:
-			columns = append(columns, sqlparser.String(expr.Expr))
 		case *sqlparser.StarExpr:
-			columns = append(columns, table.Columns...)
+			var indices []int
+			for i, c := range src.cols {
+				if expr.TableName.IsEmpty() || strings.EqualFold(c.table, expr.TableName.Name.String()) {
+					indices = append(indices, i)
+					out.cols = append(out.cols, column{name: c.name})
+				}
+			}
+			if len(indices) == 0 {
+				return nil, fmt.Errorf("table %q not found", expr.TableName.Name.String())
+			}
+			projections = append(projections, func(ctx *evalCtx) ([]any, error) {
+				vals := make([]any, len(indices))
+				if ctx.row != nil {
+					for i, idx := range indices {
+						vals[i] = ctx.row[idx]
+					}
+				}
+				return vals, nil
+			})
+		case *sqlparser.AliasedExpr:
+			out.cols = append(out.cols, column{name: columnName(expr)})
+			projections = append(projections, func(ctx *evalCtx) ([]any, error) {
+				v, err := ctx.eval(expr.Expr)
+				return []any{v}, err
+			})
 		default:
-			return nil, fmt.Errorf("only bare column names (no expressions) are supported")
+			return nil, fmt.Errorf("unsupported select expression %s", sqlparser.String(expr))
 		}
 	}
 
-	var indices []int
-	for _, col := range columns {
-		found := false
-		for i, name := range table.Columns {
-			if name == col {
-				indices = append(indices, i)
-				found = true
-				break
+	type outRow struct {
+		vals []any
+		ctx  *evalCtx
+	}
+	var results []outRow
+	seen := make(map[string]bool)
+	for _, ctx := range ctxs {
+		var vals []any
+		for _, project := range projections {
+			v, err := project(ctx)
+			if err != nil {
+				return nil, err
 			}
+			vals = append(vals, v...)
+		}
+		if sel.Distinct != "" {
+			key := rowKey(vals)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		results = append(results, outRow{vals: vals, ctx: ctx})
+	}
+
+	// ORDER BY can refer to output columns by alias or position, or to any expression of the input rows
+	if len(sel.OrderBy) > 0 {
+		keys := make([][]any, len(results))
+		for i, res := range results {
+			for _, order := range sel.OrderBy {
+				v, err := orderValue(order.Expr, out, res.vals, res.ctx)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = append(keys[i], v)
+			}
+		}
+		idx := make([]int, len(results))
+		for i := range idx {
+			idx[i] = i
 		}
-		if !found {
-			return nil, fmt.Errorf("column %q not found", col)
+		sort.SliceStable(idx, func(a, b int) bool {
+			for k, order := range sel.OrderBy {
+				c := compareValues(keys[idx[a]][k], keys[idx[b]][k])
+				if order.Direction == sqlparser.DescScr {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+		sorted := make([]outRow, len(results))
+		for i, j := range idx {
+			sorted[i] = results[j]
 		}
+		results = sorted
 	}
 
-	var rows []any
-	for _, row := range table.Rows {
-		values := make(map[string]any)
-		for _, i := range indices {
-			values[table.Columns[i]] = row[i]
+	// LIMIT
+	if sel.Limit != nil {
+		ctx := &evalCtx{db: db, outer: outer}
+		if sel.Limit.Offset != nil {
+			offset, err := ctx.evalInt(sel.Limit.Offset)
+			if err != nil {
+				return nil, fmt.Errorf("offset: %w", err)
+			}
+			results = results[min(offset, len(results)):]
+		}
+		if sel.Limit.Rowcount != nil {
+			count, err := ctx.evalInt(sel.Limit.Rowcount)
+			if err != nil {
+				return nil, fmt.Errorf("limit: %w", err)
+			}
+			results = results[:min(count, len(results))]
 		}
-		rows = append(rows, values)
 	}
 
-	result := &Result{
-		Columns: columns,
-		Rows:    rows,
+	for _, res := range results {
+		out.rows = append(out.rows, res.vals)
 	}
-	return result, nil
+	return out, nil
 }
 
-func (db *MemDB) Close() error {
-	return nil
+// group splits rows into groups with equal values for the GROUP BY expressions. Without GROUP BY, all rows
+// form a single group (even if there are no rows) so aggregates can be computed over the whole table.
+func (db *MemDB) group(src *relation, rows [][]any, groupBy sqlparser.GroupBy, outer *evalCtx) ([][][]any, error) {
+	if len(groupBy) == 0 {
+		return [][][]any{rows}, nil
+	}
+
+	var groups [][][]any
+	index := make(map[string]int)
+	for _, row := range rows {
+		ctx := &evalCtx{db: db, rel: src, row: row, outer: outer}
+		var vals []any
+		for _, expr := range groupBy {
+			v, err := ctx.eval(expr)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		key := rowKey(vals)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], row)
+	}
+	return groups, nil
+}
+
+// orderValue evaluates an ORDER BY expression for a row of the output.
+func orderValue(expr sqlparser.Expr, out *relation, vals []any, ctx *evalCtx) (any, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		if expr.Type == sqlparser.IntVal {
+			pos, err := strconv.Atoi(string(expr.Val))
+			if err != nil || pos < 1 || pos > len(vals) {
+				return nil, fmt.Errorf("ORDER BY position %s is not in select list", expr.Val)
+			}
+			return vals[pos-1], nil
+		}
+	case *sqlparser.ColName:
+		if expr.Qualifier.IsEmpty() {
+			if i, err := out.index("", expr.Name.String()); err == nil && i >= 0 {
+				return vals[i], nil
+			}
+		}
+	}
+	return ctx.eval(expr)
+}
+
+// columnName returns the name of the result column of a select expression.
+func columnName(expr *sqlparser.AliasedExpr) string {
+	if !expr.As.IsEmpty() {
+		return expr.As.String()
+	}
+	if col, ok := expr.Expr.(*sqlparser.ColName); ok {
+		return col.Name.String()
+	}
+	return sqlparser.String(expr.Expr)
+}
+
+func hasAggregate(exprs sqlparser.SelectExprs) bool {
+	found := false
+	for _, expr := range exprs {
+		sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			switch node := node.(type) {
+			case *sqlparser.Subquery:
+				return false, nil // aggregates of subqueries belong to the subquery
+			case *sqlparser.FuncExpr:
+				if node.IsAggregate() {
+					found = true
+				}
+			}
+			return !found, nil
+		}, expr)
+	}
+	return found
 }
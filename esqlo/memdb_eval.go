@@ -0,0 +1,757 @@
+package esqlo
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// evalCtx is the context an expression of a MemDB query is evaluated in: a row of a relation or, for
+// aggregates, a group of rows.
+type evalCtx struct {
+	db      *MemDB
+	rel     *relation
+	row     []any   // the current row, nil if there is none (e.g. an empty group)
+	group   [][]any // rows of the current group when evaluating aggregates
+	grouped bool    // whether the query is grouped, i.e. aggregates can be used
+	outer   *evalCtx
+}
+
+// test evaluates a predicate. NULL is treated as false.
+func (c *evalCtx) test(expr sqlparser.Expr) (bool, error) {
+	v, err := c.eval(expr)
+	if err != nil {
+		return false, err
+	}
+	if c.db.describing {
+		return true, nil // keep every row, see MemDB.Describe
+	}
+	return isTrue(v), nil
+}
+
+func (c *evalCtx) evalInt(expr sqlparser.Expr) (int, error) {
+	v, err := c.eval(expr)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("expected a non-negative integer, got %v", v)
+	}
+	return int(n), nil
+}
+
+func (c *evalCtx) column(col *sqlparser.ColName) (any, error) {
+	for ctx := c; ctx != nil; ctx = ctx.outer {
+		if ctx.rel == nil {
+			continue
+		}
+		i, err := ctx.rel.index(col.Qualifier.Name.String(), col.Name.String())
+		if err != nil {
+			return nil, err
+		}
+		if i >= 0 {
+			if ctx.row == nil {
+				return nil, nil
+			}
+			return ctx.row[i], nil
+		}
+	}
+	return nil, fmt.Errorf("column %q not found", sqlparser.String(col))
+}
+
+func (c *evalCtx) eval(expr sqlparser.Expr) (any, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.StrVal:
+			return string(expr.Val), nil
+		case sqlparser.IntVal:
+			return strconv.ParseInt(string(expr.Val), 10, 64)
+		case sqlparser.FloatVal:
+			return strconv.ParseFloat(string(expr.Val), 64)
+		}
+		return nil, fmt.Errorf("unsupported value %s", sqlparser.String(expr))
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		return bool(expr), nil
+	case *sqlparser.ColName:
+		return c.column(expr)
+	case *sqlparser.ParenExpr:
+		return c.eval(expr.Expr)
+	case *sqlparser.AndExpr:
+		l, err := c.eval(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil && !isTrue(l) {
+			return false, nil
+		}
+		r, err := c.eval(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && !isTrue(r) {
+			return false, nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return true, nil
+	case *sqlparser.OrExpr:
+		l, err := c.eval(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		if isTrue(l) {
+			return true, nil
+		}
+		r, err := c.eval(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		if isTrue(r) {
+			return true, nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return false, nil
+	case *sqlparser.NotExpr:
+		v, err := c.eval(expr.Expr)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return !isTrue(v), nil
+	case *sqlparser.ComparisonExpr:
+		return c.evalComparison(expr)
+	case *sqlparser.RangeCond:
+		v, err := c.eval(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		from, err := c.eval(expr.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := c.eval(expr.To)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil || from == nil || to == nil {
+			return nil, nil
+		}
+		in := compareValues(v, from) >= 0 && compareValues(v, to) <= 0
+		return in == (expr.Operator == sqlparser.BetweenStr), nil
+	case *sqlparser.IsExpr:
+		v, err := c.eval(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			return v == nil, nil
+		case sqlparser.IsNotNullStr:
+			return v != nil, nil
+		case sqlparser.IsTrueStr:
+			return v != nil && isTrue(v), nil
+		case sqlparser.IsNotTrueStr:
+			return v == nil || !isTrue(v), nil
+		case sqlparser.IsFalseStr:
+			return v != nil && !isTrue(v), nil
+		case sqlparser.IsNotFalseStr:
+			return v == nil || isTrue(v), nil
+		}
+	case *sqlparser.UnaryExpr:
+		v, err := c.eval(expr.Expr)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch expr.Operator {
+		case sqlparser.UPlusStr:
+			return v, nil
+		case sqlparser.UMinusStr:
+			return arith("-", int64(0), v)
+		case sqlparser.BangStr:
+			return !isTrue(v), nil
+		}
+	case *sqlparser.BinaryExpr:
+		l, err := c.eval(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := c.eval(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return arith(expr.Operator, l, r)
+	case *sqlparser.CaseExpr:
+		return c.evalCase(expr)
+	case *sqlparser.Subquery:
+		sub, err := c.subquery(expr)
+		if err != nil {
+			return nil, err
+		}
+		switch len(sub.rows) {
+		case 0:
+			return nil, nil
+		case 1:
+			return sub.rows[0][0], nil
+		}
+		return nil, fmt.Errorf("subquery returned more than one row")
+	case *sqlparser.ExistsExpr:
+		sub, err := c.db.selectRows(expr.Subquery.Select, c)
+		if err != nil {
+			return nil, err
+		}
+		return len(sub.rows) > 0, nil
+	case *sqlparser.FuncExpr:
+		if expr.IsAggregate() {
+			return c.evalAggregate(expr)
+		}
+		return c.evalFunc(expr)
+	}
+	return nil, fmt.Errorf("unsupported expression %s", sqlparser.String(expr))
+}
+
+func (c *evalCtx) evalComparison(expr *sqlparser.ComparisonExpr) (any, error) {
+	l, err := c.eval(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	switch expr.Operator {
+	case sqlparser.InStr, sqlparser.NotInStr:
+		list, err := c.evalList(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			return nil, nil
+		}
+		found, hasNull := false, false
+		for _, v := range list {
+			if v == nil {
+				hasNull = true
+			} else if compareValues(l, v) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found && hasNull {
+			return nil, nil
+		}
+		return found == (expr.Operator == sqlparser.InStr), nil
+	}
+
+	r, err := c.eval(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Operator == sqlparser.NullSafeEqualStr {
+		return l == nil && r == nil || l != nil && r != nil && compareValues(l, r) == 0, nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	switch expr.Operator {
+	case sqlparser.EqualStr:
+		return compareValues(l, r) == 0, nil
+	case sqlparser.NotEqualStr:
+		return compareValues(l, r) != 0, nil
+	case sqlparser.LessThanStr:
+		return compareValues(l, r) < 0, nil
+	case sqlparser.LessEqualStr:
+		return compareValues(l, r) <= 0, nil
+	case sqlparser.GreaterThanStr:
+		return compareValues(l, r) > 0, nil
+	case sqlparser.GreaterEqualStr:
+		return compareValues(l, r) >= 0, nil
+	case sqlparser.LikeStr, sqlparser.NotLikeStr:
+		re, err := likePattern(toString(r))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(toString(l)) == (expr.Operator == sqlparser.LikeStr), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", expr.Operator)
+}
+
+// evalList evaluates the right side of an IN expression.
+func (c *evalCtx) evalList(expr sqlparser.Expr) ([]any, error) {
+	switch expr := expr.(type) {
+	case sqlparser.ValTuple:
+		var list []any
+		for _, e := range expr {
+			v, err := c.eval(e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case *sqlparser.Subquery:
+		sub, err := c.subquery(expr)
+		if err != nil {
+			return nil, err
+		}
+		var list []any
+		for _, row := range sub.rows {
+			list = append(list, row[0])
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported IN list %s", sqlparser.String(expr))
+}
+
+// subquery evaluates a subquery that returns a single column. The subquery can refer to the columns of c.
+func (c *evalCtx) subquery(expr *sqlparser.Subquery) (*relation, error) {
+	sub, err := c.db.selectRows(expr.Select, c)
+	if err != nil {
+		return nil, err
+	}
+	if len(sub.cols) != 1 {
+		return nil, fmt.Errorf("subquery must return a single column, got %d", len(sub.cols))
+	}
+	return sub, nil
+}
+
+func (c *evalCtx) evalCase(expr *sqlparser.CaseExpr) (any, error) {
+	var subject any
+	if expr.Expr != nil {
+		var err error
+		subject, err = c.eval(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, when := range expr.Whens {
+		cond, err := c.eval(when.Cond)
+		if err != nil {
+			return nil, err
+		}
+		matches := isTrue(cond)
+		if expr.Expr != nil {
+			matches = subject != nil && cond != nil && compareValues(subject, cond) == 0
+		}
+		if matches {
+			return c.eval(when.Val)
+		}
+	}
+	if expr.Else != nil {
+		return c.eval(expr.Else)
+	}
+	return nil, nil
+}
+
+// funcArgs evaluates the arguments of a (non-aggregate) function call.
+func (c *evalCtx) funcArgs(expr *sqlparser.FuncExpr) ([]any, error) {
+	var args []any
+	for _, arg := range expr.Exprs {
+		aliased, ok := arg.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, fmt.Errorf("unsupported argument %s", sqlparser.String(arg))
+		}
+		v, err := c.eval(aliased.Expr)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+func (c *evalCtx) evalFunc(expr *sqlparser.FuncExpr) (any, error) {
+	name := expr.Name.Lowered()
+	args, err := c.funcArgs(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	nargs := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s expects %d arguments, got %d", name, n, len(args))
+		}
+		return nil
+	}
+	switch name {
+	case "coalesce", "ifnull":
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	case "concat":
+		var sb strings.Builder
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			sb.WriteString(toString(arg))
+		}
+		return sb.String(), nil
+	case "lower", "upper", "length", "trim", "abs", "round":
+		if name == "round" && len(args) == 2 {
+			break
+		}
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+
+	switch name {
+	case "lower":
+		return strings.ToLower(toString(args[0])), nil
+	case "upper":
+		return strings.ToUpper(toString(args[0])), nil
+	case "length":
+		return int64(len([]rune(toString(args[0])))), nil
+	case "trim":
+		return strings.TrimSpace(toString(args[0])), nil
+	case "abs":
+		if n, ok := toInt64(args[0]); ok {
+			if n < 0 {
+				n = -n
+			}
+			return n, nil
+		}
+		f, ok := toFloat64(args[0])
+		if !ok {
+			return nil, fmt.Errorf("abs of non-number %v", args[0])
+		}
+		return math.Abs(f), nil
+	case "round":
+		f, ok := toFloat64(args[0])
+		if !ok {
+			return nil, fmt.Errorf("round of non-number %v", args[0])
+		}
+		var digits int64
+		if len(args) == 2 {
+			digits, ok = toInt64(args[1])
+			if !ok {
+				return nil, fmt.Errorf("round expects an integer number of digits")
+			}
+		}
+		p := math.Pow(10, float64(digits))
+		return math.Round(f*p) / p, nil
+	}
+	return nil, fmt.Errorf("unknown function %s", name)
+}
+
+func (c *evalCtx) evalAggregate(expr *sqlparser.FuncExpr) (any, error) {
+	name := expr.Name.Lowered()
+	if !c.grouped {
+		return nil, fmt.Errorf("aggregate %s is not allowed here", name)
+	}
+	if len(expr.Exprs) != 1 {
+		return nil, fmt.Errorf("%s expects 1 argument", name)
+	}
+	if _, star := expr.Exprs[0].(*sqlparser.StarExpr); star {
+		if name != "count" {
+			return nil, fmt.Errorf("%s(*) is not supported", name)
+		}
+		return int64(len(c.group)), nil
+	}
+	arg, ok := expr.Exprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, fmt.Errorf("unsupported argument %s", sqlparser.String(expr.Exprs[0]))
+	}
+
+	var vals []any
+	seen := make(map[string]bool)
+	for _, row := range c.group {
+		rowCtx := &evalCtx{db: c.db, rel: c.rel, row: row, outer: c.outer}
+		v, err := rowCtx.eval(arg.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if expr.Distinct {
+			key := rowKey([]any{v})
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		vals = append(vals, v)
+	}
+
+	switch name {
+	case "count":
+		return int64(len(vals)), nil
+	case "sum", "avg":
+		if len(vals) == 0 {
+			return nil, nil
+		}
+		var sum any = int64(0)
+		for _, v := range vals {
+			var err error
+			sum, err = arith("+", sum, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if name == "avg" {
+			f, _ := toFloat64(sum)
+			return f / float64(len(vals)), nil
+		}
+		return sum, nil
+	case "min", "max":
+		var best any
+		for _, v := range vals {
+			if best == nil || name == "min" && compareValues(v, best) < 0 || name == "max" && compareValues(v, best) > 0 {
+				best = v
+			}
+		}
+		return best, nil
+	}
+	return nil, fmt.Errorf("unsupported aggregate %s", name)
+}
+
+// arith applies an arithmetic operator. Integers stay integers except for division, NULL propagates.
+func arith(op string, l, r any) (any, error) {
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	li, lok := toInt64(l)
+	ri, rok := toInt64(r)
+	if lok && rok {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "div":
+			if ri == 0 {
+				return nil, nil
+			}
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, nil
+			}
+			return li % ri, nil
+		}
+	}
+
+	lf, lok := toFloat64(l)
+	rf, rok := toFloat64(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply %s to %v and %v", op, l, r)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, nil
+		}
+		return lf / rf, nil
+	case "div":
+		if rf == 0 {
+			return nil, nil
+		}
+		return int64(lf / rf), nil
+	case "%":
+		if rf == 0 {
+			return nil, nil
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+// compareValues orders two values. NULL sorts before everything else, numbers are compared by value
+// regardless of their type and values of different types are compared by their string representation.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if ai, ok := toInt64(a); ok {
+		if bi, ok := toInt64(b); ok {
+			return cmpOrdered(ai, bi)
+		}
+	}
+	if af, ok := toFloat64(a); ok {
+		if bf, ok := toFloat64(b); ok {
+			return cmpOrdered(af, bf)
+		}
+	}
+	if at, ok := toTime(a); ok {
+		if bt, ok := toTime(b); ok {
+			return at.Compare(bt)
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ab == bb:
+				return 0
+			case !ab:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// rowKey returns a string that is equal for rows with equal values, used for DISTINCT and GROUP BY.
+func rowKey(vals []any) string {
+	var sb strings.Builder
+	for _, v := range vals {
+		if i, ok := toInt64(v); ok {
+			fmt.Fprintf(&sb, "i%d\x00", i)
+		} else if f, ok := toFloat64(v); ok {
+			fmt.Fprintf(&sb, "f%v\x00", f)
+		} else {
+			fmt.Fprintf(&sb, "%T%v\x00", v, v)
+		}
+	}
+	return sb.String()
+}
+
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return err == nil && f != 0
+	}
+	if f, ok := toFloat64(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+func toInt64(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func toFloat64(v any) (float64, bool) {
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case Decimal:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case Time:
+		return v.Time, true
+	}
+	return time.Time{}, false
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// likePattern converts a LIKE pattern into a regular expression.
+func likePattern(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
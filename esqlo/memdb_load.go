@@ -0,0 +1,234 @@
+package esqlo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadMemDB returns a MemDB with a table for each of the CSV (.csv) or JSON (.json) files, named after the file
+// without its extension, e.g. datasets/best_foods.csv is loaded as the table best_foods.
+func LoadMemDB(paths ...string) (*MemDB, error) {
+	db := &MemDB{Tables: make(map[string]*MemTable)}
+	for _, path := range paths {
+		table, err := LoadTable(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		db.Tables[name] = table
+	}
+	return db, nil
+}
+
+// LoadTable reads a table from a CSV or JSON file, see ReadCSV and ReadJSON.
+func LoadTable(path string) (*MemTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var table *MemTable
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		table, err = ReadCSV(f)
+	case ".json", ".jsonl", ".ndjson":
+		table, err = ReadJSON(f)
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// ReadCSV reads a table from CSV data where the first record holds the column names. The type of every column
+// is inferred from its values: if all values are integers the column holds int64s, if they are all numbers
+// float64s, if they are all true or false bools and otherwise strings. Empty values are NULL.
+func ReadCSV(r io.Reader) (*MemTable, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header")
+	}
+
+	table := &MemTable{Columns: records[0]}
+	for _, record := range records[1:] {
+		row := make([]any, len(record))
+		for i, v := range record {
+			row[i] = v
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	for col := range table.Columns {
+		convert := inferColumn(table.Rows, col)
+		for _, row := range table.Rows {
+			if s := row[col].(string); s == "" {
+				row[col] = nil
+			} else {
+				row[col] = convert(s)
+			}
+		}
+	}
+	return table, nil
+}
+
+// inferColumn returns a conversion for the string values of a column to the narrowest type that fits all of them.
+func inferColumn(rows [][]any, col int) func(string) any {
+	isInt, isFloat, isBool := true, true, true
+	for _, row := range rows {
+		s := row[col].(string)
+		if s == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			isInt = false
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			isFloat = false
+		}
+		if s != "true" && s != "false" {
+			isBool = false
+		}
+	}
+
+	switch {
+	case isInt:
+		return func(s string) any { i, _ := strconv.ParseInt(s, 10, 64); return i }
+	case isFloat:
+		return func(s string) any { f, _ := strconv.ParseFloat(s, 64); return f }
+	case isBool:
+		return func(s string) any { return s == "true" }
+	}
+	return func(s string) any { return s }
+}
+
+// ReadJSON reads a table from a JSON array of objects or from newline-delimited JSON objects. The columns are
+// the keys of the objects in order of first appearance, and keys missing from an object are NULL. Numbers
+// become int64 if they are integers and float64 otherwise.
+func ReadJSON(r io.Reader) (*MemTable, error) {
+	br := bufio.NewReader(r)
+	var objects []map[string]any
+	var order []string // keys in order of first appearance
+	seen := make(map[string]bool)
+	addObject := func(dec *json.Decoder) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != json.Delim('{') {
+			return fmt.Errorf("expected an object, got %v", tok)
+		}
+		obj := make(map[string]any)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			obj[key] = jsonValue(v)
+			if !seen[key] {
+				seen[key] = true
+				order = append(order, key)
+			}
+		}
+		if _, err := dec.Token(); err != nil { // closing }
+			return err
+		}
+		objects = append(objects, obj)
+		return nil
+	}
+
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	first, err := firstNonSpace(br)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if first == '[' {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	for dec.More() {
+		if err := addObject(dec); err != nil {
+			return nil, err
+		}
+	}
+
+	table := &MemTable{Columns: order}
+	for _, obj := range objects {
+		row := make([]any, len(order))
+		for i, key := range order {
+			row[i] = obj[key]
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	// columns with both integers and floats hold floats only
+	for col := range table.Columns {
+		hasFloat := false
+		for _, row := range table.Rows {
+			if _, ok := row[col].(float64); ok {
+				hasFloat = true
+				break
+			}
+		}
+		for _, row := range table.Rows {
+			if i, ok := row[col].(int64); ok && hasFloat {
+				row[col] = float64(i)
+			}
+		}
+	}
+	return table, nil
+}
+
+// firstNonSpace returns the next byte of r that is not whitespace without consuming it.
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			return b[0], nil
+		}
+		r.ReadByte()
+	}
+}
+
+// jsonValue converts the numbers of a value decoded with UseNumber into int64 or float64.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = jsonValue(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,339 @@
+package esqlo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var foodsDb = &MemDB{
+	Tables: map[string]*MemTable{
+		"foods": {
+			Columns: []string{"name", "kind", "stars", "price"},
+			Rows: [][]any{
+				{"Burger", "fast", 3, 4.5},
+				{"Pizza", "fast", 5, 8.0},
+				{"Sushi", "fine", 4, 20.0},
+				{"Salad", "fine", nil, 7.25},
+				{"Fries", "fast", 3, 2.0},
+			},
+		},
+	},
+}
+
+func TestMemDBSelect(t *testing.T) {
+	tests := []struct {
+		query   string
+		columns []string
+		rows    []any
+	}{
+		{
+			query:   "SELECT name FROM foods WHERE stars > 3 AND price < 10",
+			columns: []string{"name"},
+			rows:    []any{map[string]any{"name": "Pizza"}},
+		},
+		{
+			query:   "SELECT name AS food, stars FROM foods WHERE kind = 'fine' ORDER BY name",
+			columns: []string{"food", "stars"},
+			rows: []any{
+				map[string]any{"food": "Salad", "stars": nil},
+				map[string]any{"food": "Sushi", "stars": 4},
+			},
+		},
+		{
+			query:   "SELECT name FROM foods WHERE stars IS NULL OR name LIKE 'F%'",
+			columns: []string{"name"},
+			rows:    []any{map[string]any{"name": "Salad"}, map[string]any{"name": "Fries"}},
+		},
+		{
+			query:   "SELECT name FROM foods WHERE stars IN (4, 5) AND price BETWEEN 5 AND 25 ORDER BY stars DESC",
+			columns: []string{"name"},
+			rows:    []any{map[string]any{"name": "Pizza"}, map[string]any{"name": "Sushi"}},
+		},
+		{
+			query:   "SELECT name, price * 2 AS double FROM foods ORDER BY 2 DESC, name LIMIT 2",
+			columns: []string{"name", "double"},
+			rows: []any{
+				map[string]any{"name": "Sushi", "double": 40.0},
+				map[string]any{"name": "Pizza", "double": 16.0},
+			},
+		},
+		{
+			query:   "SELECT name FROM foods ORDER BY price LIMIT 2, 2",
+			columns: []string{"name"},
+			rows:    []any{map[string]any{"name": "Salad"}, map[string]any{"name": "Pizza"}},
+		},
+		{
+			query:   "SELECT name FROM foods ORDER BY price LIMIT 1 OFFSET 4",
+			columns: []string{"name"},
+			rows:    []any{map[string]any{"name": "Sushi"}},
+		},
+		{
+			query:   "SELECT DISTINCT kind FROM foods",
+			columns: []string{"kind"},
+			rows:    []any{map[string]any{"kind": "fast"}, map[string]any{"kind": "fine"}},
+		},
+		{
+			query:   "SELECT kind, COUNT(*) AS n, COUNT(stars), SUM(stars) AS total, AVG(price) AS avg, MIN(name), MAX(price) FROM foods GROUP BY kind ORDER BY kind",
+			columns: []string{"kind", "n", "COUNT(stars)", "total", "avg", "MIN(name)", "MAX(price)"},
+			rows: []any{
+				map[string]any{"kind": "fast", "n": int64(3), "COUNT(stars)": int64(3), "total": int64(11), "avg": 14.5 / 3, "MIN(name)": "Burger", "MAX(price)": 8.0},
+				map[string]any{"kind": "fine", "n": int64(2), "COUNT(stars)": int64(1), "total": int64(4), "avg": 13.625, "MIN(name)": "Salad", "MAX(price)": 20.0},
+			},
+		},
+		{
+			query:   "SELECT kind, COUNT(DISTINCT stars) AS n FROM foods GROUP BY kind HAVING COUNT(*) > 2",
+			columns: []string{"kind", "n"},
+			rows:    []any{map[string]any{"kind": "fast", "n": int64(2)}},
+		},
+		{
+			query:   "SELECT COUNT(*) AS n, SUM(stars) AS s FROM foods WHERE stars > 10",
+			columns: []string{"n", "s"},
+			rows:    []any{map[string]any{"n": int64(0), "s": nil}},
+		},
+		{
+			query:   "SELECT upper(name) AS n, CASE WHEN stars >= 4 THEN 'good' ELSE 'ok' END AS rating FROM foods WHERE coalesce(stars, 0) > 3",
+			columns: []string{"n", "rating"},
+			rows: []any{
+				map[string]any{"n": "PIZZA", "rating": "good"},
+				map[string]any{"n": "SUSHI", "rating": "good"},
+			},
+		},
+		{
+			query:   "SELECT f.name FROM foods AS f WHERE f.stars = 3 ORDER BY f.price",
+			columns: []string{"name"},
+			rows:    []any{map[string]any{"name": "Fries"}, map[string]any{"name": "Burger"}},
+		},
+		{
+			query:   "SELECT name FROM foods WHERE stars > 100",
+			columns: []string{"name"},
+			rows:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			res, err := foodsDb.Query(context.Background(), test.query, QueryOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.columns, res.Columns)
+			assert.Equal(t, test.rows, res.Rows)
+		})
+	}
+}
+
+func TestMemDBSelectErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"SELECT nope FROM foods", `column "nope" not found`},
+		{"SELECT * FROM nope", `table "nope" not found`},
+		{"SELECT name FROM foods WHERE COUNT(*) > 1", `aggregate count is not allowed here`},
+		{"SELECT name FROM foods ORDER BY 3", `ORDER BY position 3 is not in select list`},
+		{"SELECT nope(name) FROM foods", `unknown function nope`},
+	}
+	for _, test := range tests {
+		_, err := foodsDb.Query(context.Background(), test.query, QueryOptions{})
+		assert.EqualError(t, err, test.err, test.query)
+	}
+}
+
+var joinDb = &MemDB{
+	Tables: map[string]*MemTable{
+		"users": {
+			Columns: []string{"id", "name"},
+			Rows: [][]any{
+				{1, "John"},
+				{2, "Jane"},
+				{3, "Blake"},
+			},
+		},
+		"reviews": {
+			Columns: []string{"user_id", "restaurant", "stars"},
+			Rows: [][]any{
+				{int64(1), "McDonalds", 5},
+				{int64(2), "McDonalds", 1},
+				{int64(1), "Burger King", 3},
+				{int64(4), "Wendys", 2},
+			},
+		},
+	},
+}
+
+func TestMemDBJoins(t *testing.T) {
+	tests := []struct {
+		query string
+		rows  []any
+	}{
+		{
+			query: "SELECT u.name, r.restaurant FROM users u JOIN reviews r ON r.user_id = u.id ORDER BY u.name, r.restaurant",
+			rows: []any{
+				map[string]any{"name": "Jane", "restaurant": "McDonalds"},
+				map[string]any{"name": "John", "restaurant": "Burger King"},
+				map[string]any{"name": "John", "restaurant": "McDonalds"},
+			},
+		},
+		{
+			query: "SELECT name, COUNT(restaurant) AS n FROM users LEFT JOIN reviews ON user_id = id GROUP BY name ORDER BY n DESC, name",
+			rows: []any{
+				map[string]any{"name": "John", "n": int64(2)},
+				map[string]any{"name": "Jane", "n": int64(1)},
+				map[string]any{"name": "Blake", "n": int64(0)},
+			},
+		},
+		{
+			query: "SELECT name, restaurant FROM users RIGHT JOIN reviews ON user_id = id WHERE stars < 3 ORDER BY stars",
+			rows: []any{
+				map[string]any{"name": "Jane", "restaurant": "McDonalds"},
+				map[string]any{"name": nil, "restaurant": "Wendys"},
+			},
+		},
+		{
+			query: "SELECT u.name FROM users u, reviews r WHERE u.id = r.user_id AND r.stars = 5",
+			rows:  []any{map[string]any{"name": "John"}},
+		},
+		{
+			query: "SELECT name FROM users WHERE id IN (SELECT user_id FROM reviews WHERE restaurant = 'McDonalds') ORDER BY id",
+			rows:  []any{map[string]any{"name": "John"}, map[string]any{"name": "Jane"}},
+		},
+		{
+			query: "SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM reviews)",
+			rows:  []any{map[string]any{"name": "Blake"}},
+		},
+		{
+			query: "SELECT name FROM users u WHERE EXISTS (SELECT 1 FROM reviews WHERE user_id = u.id AND stars < 2)",
+			rows:  []any{map[string]any{"name": "Jane"}},
+		},
+		{
+			query: "SELECT name, (SELECT MAX(stars) FROM reviews WHERE user_id = u.id) AS best FROM users u ORDER BY id",
+			rows: []any{
+				map[string]any{"name": "John", "best": 5},
+				map[string]any{"name": "Jane", "best": 1},
+				map[string]any{"name": "Blake", "best": nil},
+			},
+		},
+		{
+			query: "SELECT t.restaurant, t.n FROM (SELECT restaurant, COUNT(*) AS n FROM reviews GROUP BY restaurant) AS t WHERE t.n > 1",
+			rows:  []any{map[string]any{"restaurant": "McDonalds", "n": int64(2)}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			res, err := joinDb.Query(context.Background(), test.query, QueryOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.rows, res.Rows)
+		})
+	}
+
+	_, err := joinDb.Query(context.Background(), "SELECT id FROM users a JOIN users b ON a.id = b.id", QueryOptions{})
+	assert.EqualError(t, err, `column "id" is ambiguous`)
+	_, err = joinDb.Query(context.Background(), "SELECT (SELECT name FROM users) AS n FROM reviews", QueryOptions{})
+	assert.EqualError(t, err, "subquery returned more than one row")
+}
+
+func TestMemDBWrites(t *testing.T) {
+	db := &MemDB{Tables: map[string]*MemTable{
+		"users": {Columns: []string{"id", "name", "active"}, Rows: [][]any{{1, "John", true}}},
+	}}
+	shared := db.Tables["users"]
+
+	exec := func(query string) int64 {
+		t.Helper()
+		res, err := db.Query(context.Background(), query, QueryOptions{})
+		require.NoError(t, err, query)
+		return res.Rows[0].(map[string]any)["count"].(int64)
+	}
+	assert.Equal(t, int64(2), exec("INSERT INTO users (id, name) VALUES (2, 'Jane'), (3, 'Blake')"))
+	assert.Equal(t, int64(1), exec("INSERT INTO users VALUES (4, 'Mark', false)"))
+	assert.Equal(t, int64(1), exec("INSERT INTO users (id, name) SELECT id + 10, concat(name, '2') FROM users WHERE active"))
+	assert.Equal(t, int64(3), exec("UPDATE users SET active = true, name = upper(name) WHERE active IS NULL"))
+	assert.Equal(t, int64(2), exec("DELETE FROM users WHERE id > 10 OR NOT active"))
+
+	res, err := db.Query(context.Background(), "SELECT * FROM users ORDER BY id", QueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []any{
+		map[string]any{"id": 1, "name": "John", "active": true},
+		map[string]any{"id": int64(2), "name": "JANE", "active": true},
+		map[string]any{"id": int64(3), "name": "BLAKE", "active": true},
+	}, res.Rows)
+	assert.Equal(t, [][]any{{1, "John", true}}, shared.Rows, "tables are replaced, not modified in place")
+
+	_, err = db.Query(context.Background(), "INSERT INTO users (id, nope) VALUES (1, 2)", QueryOptions{})
+	assert.EqualError(t, err, `column "nope" not found`)
+	_, err = db.Query(context.Background(), "INSERT INTO users (id) VALUES (1, 2)", QueryOptions{})
+	assert.EqualError(t, err, "INSERT has 1 columns but 2 values")
+	_, err = db.Query(context.Background(), "UPDATE nope SET id = 1", QueryOptions{})
+	assert.EqualError(t, err, `table "nope" not found`)
+	_, err = db.Query(context.Background(), "CREATE TABLE t (id int)", QueryOptions{})
+	assert.EqualError(t, err, "only SELECT, INSERT, UPDATE and DELETE statements are supported")
+}
+
+func TestLoadMemDB(t *testing.T) {
+	db, err := LoadMemDB("../datasets/best_foods.csv", "testdata/people.csv", "testdata/reviews.json", "testdata/restaurants.ndjson")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"food_name", "stars", "author", "review"}, db.Tables["best_foods"].Columns)
+	assert.Equal(t, []any{"Chicken Curry", int64(5), "mark", "It's the best curry I've ever had!!!!"}, db.Tables["best_foods"].Rows[0])
+	assert.Equal(t, &MemTable{
+		Columns: []string{"id", "name"},
+		Rows:    [][]any{{int64(42), "John"}, {int64(41), "Jane"}},
+	}, db.Tables["people"])
+	assert.Equal(t, &MemTable{
+		Columns: []string{"id", "restaurant", "stars", "tags", "meta"},
+		Rows: [][]any{
+			{int64(1), "McDonalds", 5.0, []any{"fast", "cheap"}, nil},
+			{int64(2), "McDonalds", 1.5, nil, map[string]any{"visits": int64(2)}},
+			{int64(3), "Burger King", nil, nil, nil},
+		},
+	}, db.Tables["reviews"])
+	assert.Equal(t, &MemTable{
+		Columns: []string{"id", "restaurant", "open"},
+		Rows:    [][]any{{int64(1), "McDonalds", nil}, {int64(2), nil, true}},
+	}, db.Tables["restaurants"])
+
+	res, err := db.Query(context.Background(), "SELECT food_name FROM best_foods WHERE stars >= 5 ORDER BY stars DESC LIMIT 1", QueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []any{map[string]any{"food_name": "Steak"}}, res.Rows)
+
+	csvTable, err := ReadCSV(strings.NewReader("a,b,c,d\n1,1.5,true,x\n,2,false,\n"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{int64(1), 1.5, true, "x"}, {nil, 2.0, false, nil}}, csvTable.Rows)
+
+	_, err = LoadTable("testdata/people.duckdb")
+	assert.EqualError(t, err, `testdata/people.duckdb: unsupported file type ".duckdb"`)
+}
+
+func TestMemDBArgs(t *testing.T) {
+	db := &MemDB{Tables: map[string]*MemTable{
+		"users": {Columns: []string{"id", "name"}, Rows: [][]any{{"u1", "Ann"}, {"u2", "Bob's"}}},
+	}}
+	res, err := db.Query(context.Background(), "SELECT name FROM users WHERE id = ? OR name = ?", QueryOptions{Args: []any{"u1", "Bob's"}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"Ann"}, {"Bob's"}}, res.Values)
+
+	res, err = db.Query(context.Background(), "SELECT name FROM users WHERE id = ?", QueryOptions{Args: []any{nil}})
+	require.NoError(t, err)
+	assert.Empty(t, res.Values)
+
+	_, err = db.Query(context.Background(), "SELECT name FROM users WHERE id = ? AND name = ?", QueryOptions{Args: []any{"u1"}})
+	assert.EqualError(t, err, "missing bind var v2")
+}
+
+func TestMemDBSession(t *testing.T) {
+	db := &MemDB{Tables: map[string]*MemTable{
+		"orders": {Columns: []string{"tenant", "item"}, Rows: [][]any{{"acme", "tea"}, {"globex", "cake"}}},
+	}}
+	s, err := db.Session(context.Background(), []Statement{{Query: "DELETE FROM orders WHERE tenant <> ?", Args: []any{"acme"}}})
+	require.NoError(t, err)
+	res, err := s.Query(context.Background(), "SELECT item FROM orders", QueryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"tea"}}, res.Values)
+
+	res, err = db.Query(context.Background(), "SELECT item FROM orders", QueryOptions{})
+	require.NoError(t, err)
+	assert.Len(t, res.Values, 2, "the setup of a session does not change the database")
+}
@@ -0,0 +1,182 @@
+package esqlo
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// insert evaluates an INSERT statement with VALUES or a SELECT and returns the number of inserted rows.
+// Columns that are not listed are NULL.
+func (db *MemDB) insert(stmt *sqlparser.Insert) (int, error) {
+	if stmt.Action != sqlparser.InsertStr || len(stmt.OnDup) > 0 {
+		return 0, fmt.Errorf("only plain INSERT statements are supported")
+	}
+	key, table, err := db.lookupTable(stmt.Table.Name.String())
+	if err != nil {
+		return 0, err
+	}
+
+	rel := &relation{}
+	for _, col := range table.Columns {
+		rel.cols = append(rel.cols, column{name: col})
+	}
+	var indices []int
+	if len(stmt.Columns) == 0 {
+		for i := range table.Columns {
+			indices = append(indices, i)
+		}
+	}
+	for _, col := range stmt.Columns {
+		i, err := rel.index("", col.String())
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("column %q not found", col.String())
+		}
+		indices = append(indices, i)
+	}
+
+	var values [][]any
+	switch src := stmt.Rows.(type) {
+	case sqlparser.Values:
+		ctx := &evalCtx{db: db}
+		for _, tuple := range src {
+			var vals []any
+			for _, expr := range tuple {
+				v, err := ctx.eval(expr)
+				if err != nil {
+					return 0, err
+				}
+				vals = append(vals, v)
+			}
+			values = append(values, vals)
+		}
+	case sqlparser.SelectStatement:
+		sel, err := db.selectRows(src, nil)
+		if err != nil {
+			return 0, err
+		}
+		values = sel.rows
+	default:
+		return 0, fmt.Errorf("unsupported INSERT rows %s", sqlparser.String(src))
+	}
+
+	rows := slices.Clip(table.Rows)
+	for _, vals := range values {
+		if len(vals) != len(indices) {
+			return 0, fmt.Errorf("INSERT has %d columns but %d values", len(indices), len(vals))
+		}
+		row := make([]any, len(table.Columns))
+		for i, v := range vals {
+			row[indices[i]] = v
+		}
+		rows = append(rows, row)
+	}
+	db.Tables[key] = &MemTable{Columns: table.Columns, Rows: rows}
+	return len(values), nil
+}
+
+// update evaluates an UPDATE statement and returns the number of updated rows. The new values are computed
+// from the values of the row before the update.
+func (db *MemDB) update(stmt *sqlparser.Update) (int, error) {
+	if len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		return 0, fmt.Errorf("ORDER BY and LIMIT are not supported in UPDATE")
+	}
+	key, rel, err := db.writeTarget(stmt.TableExprs)
+	if err != nil {
+		return 0, err
+	}
+
+	var indices []int
+	for _, expr := range stmt.Exprs {
+		i, err := rel.index(expr.Name.Qualifier.Name.String(), expr.Name.Name.String())
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("column %q not found", sqlparser.String(expr.Name))
+		}
+		indices = append(indices, i)
+	}
+
+	n := 0
+	rows := make([][]any, len(rel.rows))
+	for r, row := range rel.rows {
+		rows[r] = row
+		ctx := &evalCtx{db: db, rel: rel, row: row}
+		if stmt.Where != nil {
+			ok, err := ctx.test(stmt.Where.Expr)
+			if err != nil {
+				return 0, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		updated := slices.Clone(row)
+		for i, expr := range stmt.Exprs {
+			v, err := ctx.eval(expr.Expr)
+			if err != nil {
+				return 0, err
+			}
+			updated[indices[i]] = v
+		}
+		rows[r] = updated
+		n++
+	}
+	db.Tables[key] = &MemTable{Columns: db.Tables[key].Columns, Rows: rows}
+	return n, nil
+}
+
+// delete evaluates a DELETE statement and returns the number of deleted rows.
+func (db *MemDB) delete(stmt *sqlparser.Delete) (int, error) {
+	if len(stmt.Targets) > 0 || len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		return 0, fmt.Errorf("only single table DELETE statements without ORDER BY and LIMIT are supported")
+	}
+	key, rel, err := db.writeTarget(stmt.TableExprs)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows [][]any
+	for _, row := range rel.rows {
+		if stmt.Where != nil {
+			ctx := &evalCtx{db: db, rel: rel, row: row}
+			ok, err := ctx.test(stmt.Where.Expr)
+			if err != nil {
+				return 0, err
+			}
+			if !ok {
+				rows = append(rows, row)
+			}
+		}
+	}
+	db.Tables[key] = &MemTable{Columns: db.Tables[key].Columns, Rows: rows}
+	return len(rel.rows) - len(rows), nil
+}
+
+// writeTarget returns the key and contents of the single table modified by an UPDATE or DELETE statement.
+func (db *MemDB) writeTarget(exprs sqlparser.TableExprs) (string, *relation, error) {
+	if len(exprs) != 1 {
+		return "", nil, fmt.Errorf("only single table UPDATE and DELETE statements are supported")
+	}
+	aliased, ok := exprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return "", nil, fmt.Errorf("only single table UPDATE and DELETE statements are supported")
+	}
+	name, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported table expression %s", sqlparser.String(aliased))
+	}
+
+	key, _, err := db.lookupTable(name.Name.String())
+	if err != nil {
+		return "", nil, err
+	}
+	rel, err := db.tableExpr(aliased, nil)
+	return key, rel, err
+}
@@ -0,0 +1,355 @@
+package mustache
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Conditions in {{#if ...}} sections are written in a small expression language:
+//
+//	{{#if stars < 2}} ... {{else}} ... {{/if}}
+//	{{#if status == "open" && !archived}} ... {{/if}}
+//
+// Operands are names looked up in the context like variables, numbers, strings in single or double quotes,
+// true, false and null. Operators are the comparisons ==, !=, <, <=, >, >= and the logical operators
+// && (and), || (or) and ! (not). Parentheses group sub-expressions.
+
+// expr is a parsed condition that can be evaluated against a context chain.
+type expr interface {
+	eval(r *renderer, contextChain []interface{}, offset int) any
+}
+
+type literalExpr struct{ value any }
+
+type nameExpr struct{ name string }
+
+type notExpr struct{ x expr }
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (e *literalExpr) eval(r *renderer, contextChain []interface{}, offset int) any {
+	return e.value
+}
+
+func (e *nameExpr) eval(r *renderer, contextChain []interface{}, offset int) any {
+	v := indirect(r.lookup(contextChain, e.name, offset, "variable"))
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func (e *notExpr) eval(r *renderer, contextChain []interface{}, offset int) any {
+	return !truthy(e.x.eval(r, contextChain, offset))
+}
+
+func (e *binaryExpr) eval(r *renderer, contextChain []interface{}, offset int) any {
+	x := e.x.eval(r, contextChain, offset)
+	switch e.op {
+	case "&&":
+		return truthy(x) && truthy(e.y.eval(r, contextChain, offset))
+	case "||":
+		return truthy(x) || truthy(e.y.eval(r, contextChain, offset))
+	}
+
+	y := e.y.eval(r, contextChain, offset)
+	c, ok := compare(x, y)
+	switch e.op {
+	case "==":
+		return ok && c == 0
+	case "!=":
+		return !ok || c != 0
+	case "<":
+		return ok && c < 0
+	case "<=":
+		return ok && c <= 0
+	case ">":
+		return ok && c > 0
+	case ">=":
+		return ok && c >= 0
+	}
+	return false
+}
+
+// truthy reports whether v counts as true in a condition. nil, false, zero numbers, empty strings and empty
+// lists or maps are false, everything else is true.
+func truthy(v any) bool {
+	if v == nil {
+		return false
+	}
+	rv := indirect(reflect.ValueOf(v))
+	if !rv.IsValid() {
+		return false
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+// compare returns -1, 0 or 1 if x is less than, equal or greater than y. ok is false if x and y cannot be
+// compared, e.g. a string and a list. Numbers are compared by value regardless of their type and strings
+// that look like numbers are compared to numbers as numbers.
+func compare(x, y any) (c int, ok bool) {
+	if x == nil || y == nil {
+		if x == nil && y == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+
+	if xf, ok := toFloat(x); ok {
+		if yf, ok := toFloat(y); ok {
+			switch {
+			case xf < yf:
+				return -1, true
+			case xf > yf:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	if xb, ok := x.(bool); ok {
+		if yb, ok := y.(bool); ok && xb == yb {
+			return 0, true
+		}
+		return 0, false
+	}
+
+	xs, xok := x.(string)
+	ys, yok := y.(string)
+	if !xok || !yok {
+		if !reflect.TypeOf(x).Comparable() || !reflect.TypeOf(y).Comparable() {
+			return 0, false
+		}
+		xs, ys = fmt.Sprint(x), fmt.Sprint(y)
+	}
+	return strings.Compare(xs, ys), true
+}
+
+func toFloat(v any) (float64, bool) {
+	if f, ok := v.(interface{ Float64() float64 }); ok { // e.g. exact decimals
+		return f.Float64(), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// exprParser is a recursive descent parser for conditions.
+type exprParser struct {
+	toks []string
+	pos  int
+}
+
+func parseExpr(s string) (expr, error) {
+	toks, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("missing condition")
+	}
+	p := &exprParser{toks: toks}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.toks[p.pos])
+	}
+	return e, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" || p.peek() == "or" {
+		p.pos++
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" || p.peek() == "and" {
+		p.pos++
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseNot() (expr, error) {
+	if p.peek() == "!" || p.peek() == "not" {
+		p.pos++
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (expr, error) {
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+		y, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{op: op, x: x, y: y}, nil
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseOperand() (expr, error) {
+	tok := p.peek()
+	if tok == "" {
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	p.pos++
+
+	switch {
+	case tok == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case tok == "true":
+		return &literalExpr{true}, nil
+	case tok == "false":
+		return &literalExpr{false}, nil
+	case tok == "null" || tok == "nil":
+		return &literalExpr{nil}, nil
+	case tok[0] == '"' || tok[0] == '\'':
+		return &literalExpr{tok[1:]}, nil // the tokenizer has already removed the closing quote and escapes
+	case tok[0] == '-' || tok[0] >= '0' && tok[0] <= '9':
+		if i, err := strconv.ParseInt(tok, 10, 64); err == nil {
+			return &literalExpr{i}, nil
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return &literalExpr{f}, nil
+	case isNameChar(tok[0]):
+		return &nameExpr{tok}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// tokenizeExpr splits a condition into tokens. String tokens keep their opening quote to distinguish them
+// from names but have their closing quote and escapes removed.
+func tokenizeExpr(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			sb.WriteByte(c)
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, sb.String())
+			i = j + 1
+		case c == '(' || c == ')':
+			toks = append(toks, string(c))
+			i++
+		case strings.ContainsRune("=!<>&|", rune(c)):
+			if i+1 < len(s) && (s[i+1] == '=' || (c == '&' || c == '|') && s[i+1] == c) {
+				toks = append(toks, s[i:i+2])
+				i += 2
+			} else if c == '&' || c == '|' || c == '=' {
+				return nil, fmt.Errorf("unexpected %q", c)
+			} else {
+				toks = append(toks, string(c))
+				i++
+			}
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		case isNameChar(c):
+			j := i + 1
+			for j < len(s) && (isNameChar(s[j]) || s[j] >= '0' && s[j] <= '9' || s[j] == '/' || s[j] == '[' || s[j] == ']') {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.' || c == '@' || c == '$'
+}
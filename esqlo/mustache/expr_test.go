@@ -0,0 +1,63 @@
+package mustache
+
+import (
+	"strings"
+	"testing"
+)
+
+var exprTests = []Test{
+	{`{{#if stars < 2}}bad{{/if}}`, map[string]interface{}{"stars": 1}, "bad"},
+	{`{{#if stars < 2}}bad{{/if}}`, map[string]interface{}{"stars": int64(4)}, ""},
+	{`{{#if stars >= 2.5}}good{{else}}bad{{/if}}`, map[string]interface{}{"stars": 2.5}, "good"},
+	{`{{#if stars > 2}}good{{else}}bad{{/if}}`, map[string]interface{}{"stars": 1}, "bad"},
+	{`{{#if status == "open"}}open{{/if}}`, map[string]interface{}{"status": "open"}, "open"},
+	{`{{#if status != 'open'}}closed{{/if}}`, map[string]interface{}{"status": "open"}, ""},
+	{`{{#if status == "it's \"x\""}}y{{/if}}`, map[string]interface{}{"status": `it's "x"`}, "y"},
+	{`{{#if a && !b}}x{{/if}}`, map[string]interface{}{"a": true, "b": false}, "x"},
+	{`{{#if a and not b}}x{{/if}}`, map[string]interface{}{"a": true, "b": true}, ""},
+	{`{{#if a || b}}x{{/if}}`, map[string]interface{}{"a": false, "b": "yes"}, "x"},
+	{`{{#if (a || b) && c == -1}}x{{/if}}`, map[string]interface{}{"a": 1, "c": -1}, "x"},
+	{`{{#if missing == null}}x{{/if}}`, map[string]interface{}{}, "x"},
+	{`{{#if missing < 1}}x{{/if}}`, map[string]interface{}{}, ""},
+	{`{{#if count}}x{{else}}none{{/if}}`, map[string]interface{}{"count": 0}, "none"},
+	{`{{#if id == "5"}}x{{/if}}`, map[string]interface{}{"id": 5}, "x"},
+	{`{{^if a}}not a{{/if}}`, map[string]interface{}{"a": false}, "not a"},
+	{`{{#if user.age > 17}}adult{{/if}}`, map[string]interface{}{"user": map[string]int{"age": 18}}, "adult"},
+
+	// conditions use the current row as context
+	{`{{#rows}}{{#if stars < 2}}<b>{{name}}</b>{{else}}{{name}}{{/if}},{{/rows}}`, map[string]interface{}{"rows": []map[string]interface{}{
+		{"name": "a", "stars": 1}, {"name": "b", "stars": 4},
+	}}, "<b>a</b>,b,"},
+
+	// else of regular sections is rendered when the section is not
+	{`{{#rows}}{{.}}{{else}}empty{{/rows}}`, map[string]interface{}{"rows": []string{}}, "empty"},
+	{`{{#rows}}{{.}}{{else}}empty{{/rows}}`, map[string]interface{}{"rows": []string{"a"}}, "a"},
+}
+
+func TestExpr(t *testing.T) {
+	for _, test := range exprTests {
+		output := Render(test.tmpl, test.context)
+		if output != test.expected {
+			t.Errorf("%q expected %q got %q", test.tmpl, test.expected, output)
+		}
+	}
+}
+
+var malformedExpr = []Test{
+	{`{{#if}}{{/if}}`, nil, "line 1: invalid condition: missing condition"},
+	{`{{#if a <}}{{/if}}`, nil, "line 1: invalid condition: unexpected end of condition"},
+	{`{{#if a = b}}{{/if}}`, nil, `line 1: invalid condition: unexpected '='`},
+	{`{{#if "a}}{{/if}}`, nil, "line 1: invalid condition: unterminated string"},
+	{`{{#if (a}}{{/if}}`, nil, "line 1: invalid condition: missing )"},
+	{`{{#if a}}{{else}}{{else}}{{/if}}`, nil, "line 1: Section if has more than one else"},
+	{`{{else}}`, nil, "line 1: else outside of a section"},
+}
+
+func TestMalformedExpr(t *testing.T) {
+	for _, test := range malformedExpr {
+		output := Render(test.tmpl, test.context)
+		if !strings.HasPrefix(output, test.expected) {
+			t.Errorf("%q expected %q in error %q", test.tmpl, test.expected, output)
+		}
+	}
+}
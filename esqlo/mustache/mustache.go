@@ -23,15 +23,18 @@ type textElement struct {
 }
 
 type varElement struct {
-	name string
-	raw  bool
+	name   string
+	raw    bool
+	offset int // offset of the tag in the template data
 }
 
 type sectionElement struct {
 	name      string
 	inverted  bool
-	startline int
+	offset    int  // offset of the opening tag in the template data
+	cond      expr // condition of an {{#if ...}} section, nil for regular sections
 	elems     []interface{}
+	elseElems []interface{} // elements after {{else}}, rendered when elems are not
 }
 
 type Template struct {
@@ -44,12 +47,25 @@ type Template struct {
 	elems   []interface{}
 }
 
-type parseError struct {
-	line    int
-	message string
+// ParseError is returned when a template is malformed. Offset is the byte offset in the template data
+// of the tag that caused the error, and Line and Col are the 1-based position of that offset.
+type ParseError struct {
+	Line, Col int
+	Offset    int
+	Message   string
 }
 
-func (p parseError) Error() string { return fmt.Sprintf("line %d: %s", p.line, p.message) }
+func (p *ParseError) Error() string { return fmt.Sprintf("line %d: %s", p.Line, p.Message) }
+
+// errorAt returns a ParseError for the given offset in the template data.
+func (tmpl *Template) errorAt(offset int, message string) *ParseError {
+	if offset > len(tmpl.data) {
+		offset = len(tmpl.data)
+	}
+	line := 1 + strings.Count(tmpl.data[:offset], "\n")
+	col := offset - (strings.LastIndexByte(tmpl.data[:offset], '\n') + 1) + 1
+	return &ParseError{Line: line, Col: col, Offset: offset, Message: message}
+}
 
 var (
 	esc_quot = []byte("&quot;")
@@ -96,9 +112,6 @@ func (tmpl *Template) readString(s string) (string, error) {
 			i++
 		}
 	}
-
-	//should never be here
-	return "", nil
 }
 
 func (tmpl *Template) parsePartial(name string) (*Template, error) {
@@ -132,17 +145,48 @@ func (tmpl *Template) parsePartial(name string) (*Template, error) {
 	return partial, nil
 }
 
+// parseSectionTag parses a section that starts with the tag {{#name}}, {{^name}} or {{#if expression}} and
+// everything up to and including its closing tag.
+func (tmpl *Template) parseSectionTag(tag string, tagStart int) (*sectionElement, error) {
+	name := strings.TrimSpace(tag[1:])
+
+	//ignore the newline when a section starts
+	if len(tmpl.data) > tmpl.p && tmpl.data[tmpl.p] == '\n' {
+		tmpl.p += 1
+	} else if len(tmpl.data) > tmpl.p+1 && tmpl.data[tmpl.p] == '\r' && tmpl.data[tmpl.p+1] == '\n' {
+		tmpl.p += 2
+	}
+
+	se := &sectionElement{name: name, inverted: tag[0] == '^', offset: tagStart, elems: []interface{}{}}
+	if name == "if" || strings.HasPrefix(name, "if ") {
+		var err error
+		se.name = "if"
+		se.cond, err = parseExpr(name[2:])
+		if err != nil {
+			return nil, tmpl.errorAt(tagStart, "invalid condition: "+err.Error())
+		}
+	}
+	err := tmpl.parseSection(se)
+	if err != nil {
+		return nil, err
+	}
+	return se, nil
+}
+
 func (tmpl *Template) parseSection(section *sectionElement) error {
+	elems := &section.elems
+	inElse := false
 	for {
 		text, err := tmpl.readString(tmpl.otag)
 
 		if err == io.EOF {
-			return parseError{section.startline, "Section " + section.name + " has no closing tag"}
+			return tmpl.errorAt(section.offset, "Section "+section.name+" has no closing tag")
 		}
 
 		// put text into an item
 		text = text[0 : len(text)-len(tmpl.otag)]
-		section.elems = append(section.elems, &textElement{[]byte(text)})
+		tagStart := tmpl.p - len(tmpl.otag)
+		*elems = append(*elems, &textElement{[]byte(text)})
 		if tmpl.p < len(tmpl.data) && tmpl.data[tmpl.p] == '{' {
 			text, err = tmpl.readString("}" + tmpl.ctag)
 		} else {
@@ -151,39 +195,37 @@ func (tmpl *Template) parseSection(section *sectionElement) error {
 
 		if err == io.EOF {
 			//put the remaining text in a block
-			return parseError{tmpl.curline, "unmatched open tag"}
+			return tmpl.errorAt(tagStart, "unmatched open tag")
 		}
 
 		//trim the close tag off the text
 		tag := strings.TrimSpace(text[0 : len(text)-len(tmpl.ctag)])
 
 		if len(tag) == 0 {
-			return parseError{tmpl.curline, "empty tag"}
+			return tmpl.errorAt(tagStart, "empty tag")
+		}
+		if tag == "else" {
+			if inElse {
+				return tmpl.errorAt(tagStart, "Section "+section.name+" has more than one else")
+			}
+			inElse = true
+			elems = &section.elseElems
+			continue
 		}
 		switch tag[0] {
 		case '!':
 			//ignore comment
 			break
 		case '#', '^':
-			name := strings.TrimSpace(tag[1:])
-
-			//ignore the newline when a section starts
-			if len(tmpl.data) > tmpl.p && tmpl.data[tmpl.p] == '\n' {
-				tmpl.p += 1
-			} else if len(tmpl.data) > tmpl.p+1 && tmpl.data[tmpl.p] == '\r' && tmpl.data[tmpl.p+1] == '\n' {
-				tmpl.p += 2
-			}
-
-			se := sectionElement{name, tag[0] == '^', tmpl.curline, []interface{}{}}
-			err := tmpl.parseSection(&se)
+			se, err := tmpl.parseSectionTag(tag, tagStart)
 			if err != nil {
 				return err
 			}
-			section.elems = append(section.elems, &se)
+			*elems = append(*elems, se)
 		case '/':
 			name := strings.TrimSpace(tag[1:])
 			if name != section.name {
-				return parseError{tmpl.curline, "interleaved closing tag: " + name}
+				return tmpl.errorAt(tagStart, "interleaved closing tag: "+name)
 			} else {
 				return nil
 			}
@@ -191,12 +233,12 @@ func (tmpl *Template) parseSection(section *sectionElement) error {
 			name := strings.TrimSpace(tag[1:])
 			partial, err := tmpl.parsePartial(name)
 			if err != nil {
-				return err
+				return tmpl.errorAt(tagStart, err.Error())
 			}
-			section.elems = append(section.elems, partial)
+			*elems = append(*elems, partial)
 		case '=':
 			if tag[len(tag)-1] != '=' {
-				return parseError{tmpl.curline, "Invalid meta tag"}
+				return tmpl.errorAt(tagStart, "Invalid meta tag")
 			}
 			tag = strings.TrimSpace(tag[1 : len(tag)-1])
 			newtags := strings.SplitN(tag, " ", 2)
@@ -207,15 +249,23 @@ func (tmpl *Template) parseSection(section *sectionElement) error {
 		case '{':
 			if tag[len(tag)-1] == '}' {
 				//use a raw tag
-				section.elems = append(section.elems, &varElement{tag[1 : len(tag)-1], true})
+				*elems = append(*elems, &varElement{name: tag[1 : len(tag)-1], raw: true, offset: tagStart})
 			}
 		default:
-			section.elems = append(section.elems, &varElement{tag, false})
+			*elems = append(*elems, &varElement{name: tag, offset: tagStart})
 		}
 	}
 }
 
-func (tmpl *Template) parse() error {
+func (tmpl *Template) parse() (err error) {
+	var tagStart int
+	defer func() {
+		if err != nil {
+			// keep everything from the failing tag onwards as plain text so the template can still be rendered
+			tmpl.elems = append(tmpl.elems, &textElement{[]byte(tmpl.data[tagStart:])})
+		}
+	}()
+
 	for {
 		text, err := tmpl.readString(tmpl.otag)
 		if err == io.EOF {
@@ -227,6 +277,7 @@ func (tmpl *Template) parse() error {
 		// put text into an item
 		text = text[0 : len(text)-len(tmpl.otag)]
 		tmpl.elems = append(tmpl.elems, &textElement{[]byte(text)})
+		tagStart = tmpl.p - len(tmpl.otag)
 
 		if tmpl.p < len(tmpl.data) && tmpl.data[tmpl.p] == '{' {
 			text, err = tmpl.readString("}" + tmpl.ctag)
@@ -236,45 +287,39 @@ func (tmpl *Template) parse() error {
 
 		if err == io.EOF {
 			//put the remaining text in a block
-			return parseError{tmpl.curline, "unmatched open tag"}
+			return tmpl.errorAt(tagStart, "unmatched open tag")
 		}
 
 		//trim the close tag off the text
 		tag := strings.TrimSpace(text[0 : len(text)-len(tmpl.ctag)])
 		if len(tag) == 0 {
-			return parseError{tmpl.curline, "empty tag"}
+			return tmpl.errorAt(tagStart, "empty tag")
+		}
+		if tag == "else" {
+			return tmpl.errorAt(tagStart, "else outside of a section")
 		}
 		switch tag[0] {
 		case '!':
 			//ignore comment
 			break
 		case '#', '^':
-			name := strings.TrimSpace(tag[1:])
-
-			if len(tmpl.data) > tmpl.p && tmpl.data[tmpl.p] == '\n' {
-				tmpl.p += 1
-			} else if len(tmpl.data) > tmpl.p+1 && tmpl.data[tmpl.p] == '\r' && tmpl.data[tmpl.p+1] == '\n' {
-				tmpl.p += 2
-			}
-
-			se := sectionElement{name, tag[0] == '^', tmpl.curline, []interface{}{}}
-			err := tmpl.parseSection(&se)
+			se, err := tmpl.parseSectionTag(tag, tagStart)
 			if err != nil {
 				return err
 			}
-			tmpl.elems = append(tmpl.elems, &se)
+			tmpl.elems = append(tmpl.elems, se)
 		case '/':
-			return parseError{tmpl.curline, "unmatched close tag"}
+			return tmpl.errorAt(tagStart, "unmatched close tag")
 		case '>':
 			name := strings.TrimSpace(tag[1:])
 			partial, err := tmpl.parsePartial(name)
 			if err != nil {
-				return err
+				return tmpl.errorAt(tagStart, err.Error())
 			}
 			tmpl.elems = append(tmpl.elems, partial)
 		case '=':
 			if tag[len(tag)-1] != '=' {
-				return parseError{tmpl.curline, "Invalid meta tag"}
+				return tmpl.errorAt(tagStart, "Invalid meta tag")
 			}
 			tag = strings.TrimSpace(tag[1 : len(tag)-1])
 			newtags := strings.SplitN(tag, " ", 2)
@@ -285,17 +330,53 @@ func (tmpl *Template) parse() error {
 		case '{':
 			//use a raw tag
 			if tag[len(tag)-1] == '}' {
-				tmpl.elems = append(tmpl.elems, &varElement{tag[1 : len(tag)-1], true})
+				tmpl.elems = append(tmpl.elems, &varElement{name: tag[1 : len(tag)-1], raw: true, offset: tagStart})
 			}
 		default:
-			tmpl.elems = append(tmpl.elems, &varElement{tag, false})
+			tmpl.elems = append(tmpl.elems, &varElement{name: tag, offset: tagStart})
 		}
 	}
 }
 
+// Getter is implemented by context values that resolve some names themselves, such as metadata of a list
+// that has no field or key of its own. Get returns false for names it does not know, which are then looked
+// up as usual.
+type Getter interface {
+	Get(name string) (any, bool)
+}
+
+// Lister is implemented by context values that act as a list of elements, e.g. in sections and index lookups.
+type Lister interface {
+	List() []any
+}
+
+// asLister returns the elements of v if it implements Lister.
+func asLister(v reflect.Value) (reflect.Value, bool) {
+	if !v.CanInterface() {
+		return v, false
+	}
+	if l, ok := v.Interface().(Lister); ok {
+		return reflect.ValueOf(l.List()), true
+	}
+	return v, false
+}
+
 // Evaluate interfaces and pointers looking for a value that can look up the name, via a
 // struct field, method, or map key, and return the result of the lookup.
 func lookup(contextChain []interface{}, name string) reflect.Value {
+	// parent context, e.g. {{../name}} looks up name in the context enclosing the current section
+	if rest, ok := strings.CutPrefix(name, "../"); ok {
+		if len(contextChain) < 2 {
+			return reflect.Value{}
+		}
+		return lookup(contextChain[1:], rest)
+	}
+
+	// loop metadata, e.g. {{@index}}
+	if strings.HasPrefix(name, "@") {
+		return lookupLoop(contextChain, name)
+	}
+
 	// dot notation
 	if name != "." && strings.Contains(name, ".") {
 		parts := strings.SplitN(name, ".", 2)
@@ -304,19 +385,24 @@ func lookup(contextChain []interface{}, name string) reflect.Value {
 		return lookup([]interface{}{v}, parts[1])
 	}
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Panic while looking up %q: %s\n", name, r)
-		}
-	}()
-
 Outer:
 	for _, ctx := range contextChain { //i := len(contextChain) - 1; i >= 0; i-- {
-		v := ctx.(reflect.Value)
+		v := contextValue(ctx)
 		for v.IsValid() {
 			if name == "." {
 				return v
 			}
+			if v.CanInterface() {
+				if g, ok := v.Interface().(Getter); ok {
+					if ret, ok := g.Get(name); ok {
+						return reflect.ValueOf(ret)
+					}
+				}
+			}
+			if l, ok := asLister(v); ok {
+				v = l
+				continue
+			}
 			switch av := v; av.Kind() {
 			case reflect.Ptr:
 				v = av.Elem()
@@ -363,6 +449,53 @@ Outer:
 	return reflect.Value{}
 }
 
+// loopFrame is the context of one element of a list that a section iterates over.
+type loopFrame struct {
+	value         reflect.Value
+	index, length int
+}
+
+// contextValue returns the value of an element in the context chain.
+func contextValue(ctx interface{}) reflect.Value {
+	if f, ok := ctx.(*loopFrame); ok {
+		return f.value
+	}
+	return ctx.(reflect.Value)
+}
+
+// lookupLoop returns the metadata of the innermost loop in the context chain:
+//
+//	@index  0-based index of the element
+//	@number 1-based index of the element
+//	@first  true for the first element
+//	@last   true for the last element
+//	@odd    true for the 1st, 3rd, 5th, ... element
+//	@even   true for the 2nd, 4th, 6th, ... element
+func lookupLoop(contextChain []interface{}, name string) reflect.Value {
+	for _, ctx := range contextChain {
+		f, ok := ctx.(*loopFrame)
+		if !ok {
+			continue
+		}
+		switch name {
+		case "@index":
+			return reflect.ValueOf(f.index)
+		case "@number":
+			return reflect.ValueOf(f.index + 1)
+		case "@first":
+			return reflect.ValueOf(f.index == 0)
+		case "@last":
+			return reflect.ValueOf(f.index == f.length-1)
+		case "@odd":
+			return reflect.ValueOf(f.index%2 == 0)
+		case "@even":
+			return reflect.ValueOf(f.index%2 == 1)
+		}
+		return reflect.Value{}
+	}
+	return reflect.Value{}
+}
+
 // normalizeNames converts "foo[0].bar[1]" into "foo.[0].bar.[1]" and "foo.bar" into "foo.bar".
 func normalizeNames(s string) (r string) {
 	for j := 0; j < len(s); j++ {
@@ -374,6 +507,26 @@ func normalizeNames(s string) (r string) {
 	return r
 }
 
+// firstIndices replaces the indices in a name with 0, e.g. "foo[2].bar[1]" with "foo[0].bar[0]".
+func firstIndices(name string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(name, '[')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(name[start:], ']')
+		if end < 0 {
+			break
+		}
+		b.WriteString(name[:start])
+		b.WriteString("[0]")
+		name = name[start+end+1:]
+	}
+	b.WriteString(name)
+	return b.String()
+}
+
 func isEmpty(v reflect.Value) bool {
 	if !v.IsValid() || v.Interface() == nil {
 		return true
@@ -396,6 +549,10 @@ func isEmpty(v reflect.Value) bool {
 func indirect(v reflect.Value) reflect.Value {
 loop:
 	for v.IsValid() {
+		if l, ok := asLister(v); ok {
+			v = l
+			continue
+		}
 		switch av := v; av.Kind() {
 		case reflect.Ptr:
 			v = av.Elem()
@@ -408,24 +565,78 @@ loop:
 	return v
 }
 
-func renderSection(section *sectionElement, contextChain []interface{}, buf io.Writer) {
-	value := lookup(contextChain, section.name)
-	var context = contextChain[len(contextChain)-1].(reflect.Value)
+// RenderError is an error that occurred while rendering a template, such as a name that could not be resolved in
+// strict mode. Offset is the byte offset of the offending tag in the template data.
+type RenderError struct {
+	Offset     int
+	Name       string // the name that was looked up
+	Unresolved bool   // true if the error is because Name could not be resolved
+	Message    string
+}
+
+func (e *RenderError) Error() string { return e.Message }
+
+// renderer holds the state of a single render of a template.
+type renderer struct {
+	strict bool
+	check  bool // render every branch once, see Template.Check
+	errs   []*RenderError
+}
+
+// lookup resolves name in the context chain and records an error if the lookup panics or, in strict mode,
+// if the name cannot be resolved.
+func (r *renderer) lookup(contextChain []interface{}, name string, offset int, what string) (v reflect.Value) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.errs = append(r.errs, &RenderError{Offset: offset, Name: name, Message: fmt.Sprintf("panic while looking up %q: %v", name, p)})
+			v = reflect.Value{}
+		}
+	}()
+
+	v = lookup(contextChain, normalizeNames(name))
+	if !v.IsValid() && r.check && strings.Contains(name, "[") {
+		// the lengths of lists are unknown when checking, so any index refers to the first element
+		v = lookup(contextChain, normalizeNames(firstIndices(name)))
+	}
+	if !v.IsValid() && r.strict {
+		r.errs = append(r.errs, &RenderError{Offset: offset, Name: name, Unresolved: true, Message: fmt.Sprintf("unknown %s %q", what, name)})
+	}
+	return v
+}
+
+func (r *renderer) renderSection(section *sectionElement, contextChain []interface{}, buf io.Writer) {
+	if r.check {
+		r.checkSection(section, contextChain, buf)
+		return
+	}
+	if section.cond != nil {
+		// conditions do not introduce a new context, the section is rendered with the enclosing one
+		elems := section.elems
+		if truthy(section.cond.eval(r, contextChain, section.offset)) == section.inverted {
+			elems = section.elseElems
+		}
+		for _, elem := range elems {
+			r.renderElement(elem, contextChain, buf)
+		}
+		return
+	}
+
+	value := r.lookup(contextChain, section.name, section.offset, "section")
+	var context = contextValue(contextChain[len(contextChain)-1])
 	var contexts = []interface{}{}
 	// if the value is nil, check if it's an inverted section
 	isEmpty := isEmpty(value)
 	if isEmpty && !section.inverted || !isEmpty && section.inverted {
+		for _, elem := range section.elseElems {
+			r.renderElement(elem, contextChain, buf)
+		}
 		return
 	} else if !section.inverted {
 		valueInd := indirect(value)
 		switch val := valueInd; val.Kind() {
-		case reflect.Slice:
-			for i := 0; i < val.Len(); i++ {
-				contexts = append(contexts, val.Index(i))
-			}
-		case reflect.Array:
+		case reflect.Slice, reflect.Array:
 			for i := 0; i < val.Len(); i++ {
-				contexts = append(contexts, val.Index(i))
+				contexts = append(contexts, &loopFrame{value: val.Index(i), index: i, length: val.Len()})
 			}
 		case reflect.Map, reflect.Struct:
 			contexts = append(contexts, value)
@@ -442,25 +653,58 @@ func renderSection(section *sectionElement, contextChain []interface{}, buf io.W
 	for _, ctx := range contexts {
 		chain2[0] = ctx
 		for _, elem := range section.elems {
-			renderElement(elem, chain2, buf)
+			r.renderElement(elem, chain2, buf)
+		}
+	}
+}
+
+// checkSection renders both branches of a section once. Sections over lists are rendered with their first
+// element, and are skipped if the list is empty or nil, since the names of its elements are unknown.
+func (r *renderer) checkSection(section *sectionElement, contextChain []interface{}, buf io.Writer) {
+	for _, elem := range section.elseElems {
+		r.renderElement(elem, contextChain, buf)
+	}
+	if section.cond != nil {
+		section.cond.eval(r, contextChain, section.offset)
+	}
+	if section.cond != nil || section.inverted {
+		for _, elem := range section.elems {
+			r.renderElement(elem, contextChain, buf)
 		}
+		return
+	}
+
+	value := r.lookup(contextChain, section.name, section.offset, "section")
+	var context interface{}
+	switch val := indirect(value); val.Kind() {
+	case reflect.Invalid:
+		return
+	case reflect.Slice, reflect.Array:
+		if val.Len() == 0 {
+			return
+		}
+		context = &loopFrame{value: val.Index(0), index: 0, length: val.Len()}
+	case reflect.Map, reflect.Struct:
+		context = value
+	default:
+		context = contextValue(contextChain[len(contextChain)-1])
+	}
+	chain2 := make([]interface{}, len(contextChain)+1)
+	copy(chain2[1:], contextChain)
+	chain2[0] = context
+	for _, elem := range section.elems {
+		r.renderElement(elem, chain2, buf)
 	}
 }
 
-func renderElement(element interface{}, contextChain []interface{}, buf io.Writer) {
+func (r *renderer) renderElement(element interface{}, contextChain []interface{}, buf io.Writer) {
 	switch elem := element.(type) {
 	case *textElement:
 		buf.Write(elem.text)
 	case *varElement:
-		name := normalizeNames(elem.name)
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Printf("Panic while looking up %q: %s\n", elem.name, r)
-			}
-		}()
-		val := lookup(contextChain, name)
+		val := r.lookup(contextChain, elem.name, elem.offset, "variable")
 
-		if val.IsValid() {
+		if indirect(val).IsValid() { // nil values, e.g. NULL in a row, render as nothing
 			if elem.raw {
 				fmt.Fprint(buf, val.Interface())
 			} else {
@@ -469,27 +713,48 @@ func renderElement(element interface{}, contextChain []interface{}, buf io.Write
 			}
 		}
 	case *sectionElement:
-		renderSection(elem, contextChain, buf)
+		r.renderSection(elem, contextChain, buf)
 	case *Template:
-		elem.renderTemplate(contextChain, buf)
+		r.renderTemplate(elem, contextChain, buf)
 	}
 }
 
-func (tmpl *Template) renderTemplate(contextChain []interface{}, buf io.Writer) {
+func (r *renderer) renderTemplate(tmpl *Template, contextChain []interface{}, buf io.Writer) {
 	for _, elem := range tmpl.elems {
-		renderElement(elem, contextChain, buf)
+		r.renderElement(elem, contextChain, buf)
 	}
 }
 
 func (tmpl *Template) Render(context ...interface{}) string {
 	var buf bytes.Buffer
+	tmpl.Execute(&buf, false, context...)
+	return buf.String()
+}
+
+// Execute renders the template to w and returns the errors that occurred while rendering. If strict is set,
+// every variable or section name that cannot be resolved is reported as an error instead of rendering as empty.
+func (tmpl *Template) Execute(w io.Writer, strict bool, context ...interface{}) []*RenderError {
 	var contextChain []interface{}
 	for _, c := range context {
 		val := reflect.ValueOf(c)
 		contextChain = append(contextChain, val)
 	}
-	tmpl.renderTemplate(contextChain, &buf)
-	return buf.String()
+	r := &renderer{strict: strict}
+	r.renderTemplate(tmpl, contextChain, w)
+	return r.errs
+}
+
+// Check is like Execute in strict mode but renders every branch of the template once, so that every name is
+// looked up: both branches of conditions and of inverted sections, and sections over lists with their first
+// element. It returns the errors, the rendered output is discarded.
+func (tmpl *Template) Check(context ...interface{}) []*RenderError {
+	var contextChain []interface{}
+	for _, c := range context {
+		contextChain = append(contextChain, reflect.ValueOf(c))
+	}
+	r := &renderer{strict: true, check: true}
+	r.renderTemplate(tmpl, contextChain, io.Discard)
+	return r.errs
 }
 
 func (tmpl *Template) RenderInLayout(layout *Template, context ...interface{}) string {
@@ -500,18 +765,20 @@ func (tmpl *Template) RenderInLayout(layout *Template, context ...interface{}) s
 	return layout.Render(allContext...)
 }
 
+// ParseString parses a template from data. If the template is malformed, a *ParseError is returned together with
+// a partial template that renders everything before the malformed tag and the remaining data as plain text.
 func ParseString(data string) (*Template, error) {
-	cwd := os.Getenv("CWD")
-	tmpl := Template{data, "{{", "}}", 0, 1, cwd, []interface{}{}}
-	err := tmpl.parse()
-
-	if err != nil {
-		return nil, err
-	}
+	return ParseStringIn(data, os.Getenv("CWD"))
+}
 
+// ParseStringIn is like ParseString but loads partials like {{> header}} from the directory dir.
+func ParseStringIn(data, dir string) (*Template, error) {
+	tmpl := Template{data, "{{", "}}", 0, 1, dir, []interface{}{}}
+	err := tmpl.parse()
 	return &tmpl, err
 }
 
+// ParseFile parses the template in filename. Like ParseString, a partial template is returned on parse errors.
 func ParseFile(filename string) (*Template, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -522,12 +789,7 @@ func ParseFile(filename string) (*Template, error) {
 
 	tmpl := Template{string(data), "{{", "}}", 0, 1, dirname, []interface{}{}}
 	err = tmpl.parse()
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &tmpl, nil
+	return &tmpl, err
 }
 
 func Render(data string, context ...interface{}) string {
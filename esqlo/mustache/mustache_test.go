@@ -2,6 +2,7 @@ package mustache
 
 import (
 	"path"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -83,6 +84,7 @@ var tests = []Test{
 	{`{{arr[0].Name}}`, map[string]interface{}{"arr": []User{{"Mike", 1}}}, "Mike"},
 	{`{{arr[0]}}{{arr[2]}}{{arr[999]}}`, map[string]interface{}{"arr": []string{"a", "b", "c"}}, "ac"},
 	{`{{arr[v]}}`, map[string]interface{}{"arr": []string{"a", "b", "c"}}, ""}, // error invalid index
+	{`[{{a}}{{b}}]`, map[string]interface{}{"a": nil, "b": (*int)(nil)}, "[]"}, // nil values render as nothing
 	{`{{arr[2][1]}}`, map[string]interface{}{"arr": [][]string{{"a"}, {"b"}, {"c", "d"}}, "v": 1}, "d"},
 
 	{`hello world`, nil, "hello world"},
@@ -229,3 +231,128 @@ func TestLayout(t *testing.T) {
 		}
 	}
 }
+
+func TestParseErrorPosition(t *testing.T) {
+	tmpl, err := ParseString("{{y}}\nb {{#x}}\n{{y}}")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %T: %v", err, err)
+	}
+	if perr.Line != 2 || perr.Col != 3 || perr.Offset != 8 {
+		t.Fatalf("expected error at 2:3 (offset 8), got %d:%d (offset %d)", perr.Line, perr.Col, perr.Offset)
+	}
+
+	// everything before the malformed section is still rendered, the rest is kept verbatim
+	output := tmpl.Render(map[string]string{"y": "y"})
+	if output != "y\nb {{#x}}\n{{y}}" {
+		t.Fatalf("partial render expected %q got %q", "y\nb {{#x}}\n{{y}}", output)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tmpl, err := ParseString("{{name}} {{nmae}}\n{{#users}}{{Name}}{{Nmae}}{{/users}}{{^missing}}!{{/missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := map[string]interface{}{"name": "a", "users": []User{{"Mike", 1}}}
+
+	var buf strings.Builder
+	errs := tmpl.Execute(&buf, false, context)
+	if len(errs) != 0 || buf.String() != "a \nMike!" {
+		t.Fatalf("non-strict expected %q and no errors, got %q and %v", "a \nMike!", buf.String(), errs)
+	}
+
+	buf.Reset()
+	errs = tmpl.Execute(&buf, true, context)
+	if buf.String() != "a \nMike!" {
+		t.Fatalf("strict expected %q got %q", "a \nMike!", buf.String())
+	}
+	expected := []RenderError{
+		{Offset: 9, Name: "nmae", Unresolved: true, Message: `unknown variable "nmae"`},
+		{Offset: 36, Name: "Nmae", Unresolved: true, Message: `unknown variable "Nmae"`},
+		{Offset: 54, Name: "missing", Unresolved: true, Message: `unknown section "missing"`},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if *err != expected[i] {
+			t.Errorf("error %d: expected %+v got %+v", i, expected[i], *err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tmpl, err := ParseString("{{#if n > 1}}{{nmae}}{{else}}{{name}}{{/if}}{{^users}}{{none}}{{/users}}" +
+		"{{#users}}{{Name}}{{Nmae}}{{/users}}{{#empty}}{{x}}{{/empty}}{{users[3].Name}}{{users[3].Nmae}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := map[string]interface{}{"n": 0, "name": "a", "users": []User{{"Mike", 1}}, "empty": []User{}}
+
+	var names []string
+	for _, err := range tmpl.Check(context) {
+		names = append(names, err.Name)
+	}
+	expected := []string{"nmae", "none", "Nmae", "users[3].Nmae"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected unresolved names %v, got %v", expected, names)
+	}
+}
+
+var loopTests = []Test{
+	{`{{#list}}{{@index}}{{@number}}{{/list}}`, map[string]interface{}{"list": []string{"a", "b"}}, "0112"},
+	{`{{#list}}{{.}}{{^@last}}, {{/@last}}{{/list}}`, map[string]interface{}{"list": []string{"a", "b", "c"}}, "a, b, c"},
+	{`{{#list}}{{#@first}}[{{/@first}}{{.}}{{/list}}`, map[string]interface{}{"list": []string{"a", "b"}}, "[ab"},
+	{`{{#list}}<tr class="{{#@odd}}odd{{/@odd}}{{#@even}}even{{/@even}}">{{/list}}`, map[string]interface{}{"list": []int{1, 2, 3}}, `<tr class="odd"><tr class="even"><tr class="odd">`},
+	{`{{#list}}{{#if @index > 0}},{{/if}}{{.}}{{/list}}`, map[string]interface{}{"list": []int{1, 2, 3}}, "1,2,3"},
+	{`{{@index}}`, map[string]interface{}{}, ""},
+
+	// parent contexts
+	{`{{#restaurants}}{{#reviews}}{{../name}}:{{stars}} {{/reviews}}{{/restaurants}}`, map[string]interface{}{"restaurants": []map[string]interface{}{
+		{"name": "a", "reviews": []map[string]interface{}{{"stars": 1}, {"stars": 2}}},
+		{"name": "b", "reviews": []map[string]interface{}{{"stars": 3}}},
+	}}, "a:1 a:2 b:3 "},
+	{`{{#outer}}{{#inner}}{{../@index}}.{{@index}} {{/inner}}{{/outer}}`, map[string]interface{}{"outer": []map[string]interface{}{
+		{"inner": []int{1, 2}}, {"inner": []int{1}},
+	}}, "0.0 0.1 1.0 "},
+	{`{{#a}}{{../../x}}{{/a}}`, map[string]interface{}{"a": []int{1}, "x": "x"}, ""},
+}
+
+func TestLoop(t *testing.T) {
+	for _, test := range loopTests {
+		output := Render(test.tmpl, test.context)
+		if output != test.expected {
+			t.Errorf("%q expected %q got %q", test.tmpl, test.expected, output)
+		}
+	}
+}
+
+// table is a list of rows with a count, like a query result.
+type table struct {
+	rows []any
+}
+
+func (t *table) List() []any { return t.rows }
+
+func (t *table) Get(name string) (any, bool) {
+	if name == "$count" {
+		return len(t.rows), true
+	}
+	return nil, false
+}
+
+var listerTests = []Test{
+	{`{{#t}}{{name}} {{/t}}`, map[string]interface{}{"t": &table{[]any{map[string]any{"name": "a"}, map[string]any{"name": "b"}}}}, "a b "},
+	{`{{t.$count}} {{t[1].name}} {{t.name}}`, map[string]interface{}{"t": &table{[]any{map[string]any{"name": "a"}, map[string]any{"name": "b"}}}}, "2 b a"},
+	{`{{#t}}x{{/t}}{{^t}}empty{{/t}}{{#if t}}x{{/if}}`, map[string]interface{}{"t": &table{}}, "empty"},
+}
+
+func TestLister(t *testing.T) {
+	for _, test := range listerTests {
+		output := Render(test.tmpl, test.context)
+		if output != test.expected {
+			t.Errorf("%q expected %q got %q", test.tmpl, test.expected, output)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package esqlo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageParam is the query parameter that selects the page of paginated sql tags, e.g. ?page=2. It selects the
+// page of all paginated tags of a document at once.
+const PageParam = "page"
+
+// Page describes the page of a paginated result:
+//
+//	<sql id="items" paginate="50">SELECT * FROM items ORDER BY id</sql>
+//	{{#items}}...{{/items}}
+//	Page {{items.$page}} of {{items.$total_pages}}
+//	{{#items.$has_next}}<a href="{{items.$next_url}}">Next</a>{{/items.$has_next}}
+type Page struct {
+	Number  int  // the 1-based number of the page
+	Size    int  // the maximum number of rows on a page
+	Total   int  // the total number of rows of all pages, -1 if unknown
+	HasNext bool // true if there are rows after this page
+
+	url *url.URL // the URL of the rendered page, to link to other pages
+}
+
+// TotalPages returns the number of pages, or -1 if the total number of rows is unknown.
+func (p *Page) TotalPages() int {
+	if p.Total < 0 {
+		return -1
+	}
+	return max(1, (p.Total+p.Size-1)/p.Size)
+}
+
+// pageURL returns the URL of the rendered page with the page parameter set to n.
+func (p *Page) pageURL(n int) string {
+	u := url.URL{}
+	if p.url != nil {
+		u = url.URL{Path: p.url.Path, RawQuery: p.url.RawQuery}
+	}
+	q := u.Query()
+	q.Set(PageParam, strconv.Itoa(n))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// get resolves the page metadata of a result in templates, see Result.Get.
+func (p *Page) get(name string) (any, bool) {
+	switch name {
+	case "$page":
+		return p.Number, true
+	case "$page_size":
+		return p.Size, true
+	case "$total":
+		if p.Total < 0 {
+			return nil, true
+		}
+		return p.Total, true
+	case "$total_pages":
+		if p.Total < 0 {
+			return nil, true
+		}
+		return p.TotalPages(), true
+	case "$has_next":
+		return p.HasNext, true
+	case "$has_prev":
+		return p.Number > 1, true
+	case "$next_url":
+		if !p.HasNext {
+			return "", true
+		}
+		return p.pageURL(p.Number + 1), true
+	case "$prev_url":
+		if p.Number <= 1 {
+			return "", true
+		}
+		return p.pageURL(p.Number - 1), true
+	}
+	return nil, false
+}
+
+// paginate runs the query of a tag with paginate set for the page selected by the URL of the renderer. The
+// query is wrapped in a subquery with LIMIT and OFFSET, so it works for any query the database can use as a
+// derived table. Unless the tag disables it with total="false", a second query counts the rows of all pages.
+func (r *Renderer) paginate(ctx context.Context, tag *SqlTag, opts QueryOptions) (*Result, error) {
+	page := &Page{Number: 1, Size: tag.Paginate, Total: -1, url: r.URL}
+	if r.URL != nil {
+		if n, err := strconv.Atoi(r.URL.Query().Get(PageParam)); err == nil && n > 0 {
+			page.Number = min(n, math.MaxInt/page.Size) // the offset of the page must not overflow
+		}
+	}
+
+	query := strings.TrimRight(strings.TrimSpace(tag.Query), ";")
+	if !tag.NoTotal {
+		res, err := tag.Database.Query(ctx, fmt.Sprintf("SELECT count(*) AS total FROM (%s) AS __page", query), QueryOptions{Args: opts.Args})
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Values) != 1 {
+			return nil, fmt.Errorf("counting rows: expected 1 row, got %d", len(res.Values))
+		}
+		total, ok := toInt64(res.Values[0][0])
+		if !ok {
+			return nil, fmt.Errorf("counting rows: unexpected count %v", res.Values[0][0])
+		}
+		page.Total = int(total)
+	}
+
+	// fetch one more row than fits on the page to know if there is a next page
+	res, err := tag.Database.Query(ctx, fmt.Sprintf("SELECT * FROM (%s) AS __page LIMIT %d OFFSET %d",
+		query, page.Size+1, (page.Number-1)*page.Size), opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Values) > page.Size {
+		res.Truncated = false // only the row of the next page was left out
+		page.HasNext = true
+		res.Values = res.Values[:page.Size]
+		res.Rows = res.Rows[:page.Size]
+	}
+	res.Page = page
+	return res, nil
+}
+
+// parsePageSize parses the page size of the paginate attribute.
+func parsePageSize(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("paginate must be a positive number of rows, got %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,58 @@
+package esqlo
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var itemsDb = &MemDB{Tables: map[string]*MemTable{
+	"items": {
+		Columns: []string{"id"},
+		Rows:    [][]any{{1}, {2}, {3}, {4}, {5}},
+	},
+}}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		url, attrs, expected string
+	}{
+		{"/list.html", `paginate="2"`, `1 2 | page 1 of 3 (5) next=/list.html?page=2 prev=`},
+		{"/list.html?page=2&q=x", `paginate="2"`, `3 4 | page 2 of 3 (5) next=/list.html?page=3&q=x prev=/list.html?page=1&q=x`},
+		{"/list.html?page=3", `paginate="2"`, `5 | page 3 of 3 (5) next= prev=/list.html?page=2`},
+		{"/list.html?page=9", `paginate="2"`, `| page 9 of 3 (5) next= prev=/list.html?page=8`},
+		{"/list.html?page=9223372036854775807", `paginate="2"`, `| page 4611686018427387903 of 3 (5) next= prev=/list.html?page=4611686018427387902`},
+		{"/list.html?page=nope", `paginate="5"`, `1 2 3 4 5 | page 1 of 1 (5) next= prev=`},
+		{"/list.html?page=2", `paginate="2" total="false"`, `3 4 | page 2 of  () next=/list.html?page=3 prev=/list.html?page=1`},
+	}
+	for _, test := range tests {
+		t.Run(test.url+" "+test.attrs, func(t *testing.T) {
+			renderer := NewRenderer()
+			renderer.Databases[ImplicitDb] = itemsDb
+			u, err := url.Parse(test.url)
+			require.NoError(t, err)
+			renderer.URL = u
+
+			var out bytes.Buffer
+			src := `<sql id="items" ` + test.attrs + `>SELECT id FROM items ORDER BY id;</sql>` +
+				`{{#items}}{{id}} {{/items}}| page {{items.$page}} of {{items.$total_pages}} ({{items.$total}}) ` +
+				`next={{{items.$next_url}}} prev={{{items.$prev_url}}}`
+			err = renderer.RenderHTML(strings.NewReader(src), &out)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestPaginateErrors(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = itemsDb
+
+	var out bytes.Buffer
+	err := renderer.RenderHTML(strings.NewReader(`<sql id="items" paginate="-1">SELECT id FROM items</sql>`), &out)
+	assert.EqualError(t, err, `[1:1] paginate must be a positive number of rows, got "-1"`)
+}
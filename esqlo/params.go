@@ -0,0 +1,109 @@
+package esqlo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bindParams replaces the named parameters of a query, e.g. :user_id, with ? placeholders and returns the
+// values of the placeholders in order. Only the names in params are replaced, so casts like x::INT, named
+// arguments like header := true and the contents of strings are left alone. Names are matched regardless of
+// case, e.g. :name binds the parameter Name of the route [Name].html.
+func bindParams(query string, params map[string]any) (string, []any, error) {
+	if len(params) == 0 || !strings.Contains(query, ":") {
+		return query, nil, nil
+	}
+	toks, err := scanSQL(query)
+	if err != nil {
+		return "", nil, err
+	}
+	var sb strings.Builder
+	var args []any
+	last := 0
+	for i := 0; i+1 < len(toks); i++ {
+		colon, name := toks[i], toks[i+1]
+		if colon.Text != ":" || name.Kind != sqlWord || name.Offset != colon.End {
+			continue
+		}
+		if i > 0 && toks[i-1].Text == ":" && toks[i-1].End == colon.Offset {
+			continue // a cast like x::user_id
+		}
+		value, ok := param(params, name.Text)
+		if !ok {
+			continue
+		}
+		sb.WriteString(query[last:colon.Offset])
+		sb.WriteString("?")
+		args = append(args, value)
+		last = name.End
+		i++
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), args, nil
+}
+
+// param returns the value of the parameter with the name, preferring an exact match, then a lower case one like
+// user_id, over one of another case.
+func param(params map[string]any, name string) (any, bool) {
+	if value, ok := params[name]; ok {
+		return value, true
+	}
+	if value, ok := params[strings.ToLower(name)]; ok {
+		return value, true
+	}
+	for k, value := range params {
+		if strings.EqualFold(k, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// inlineArgs replaces the ? placeholders of a query with the values of args as SQL literals, for statements
+// that cannot have placeholders such as CREATE VIEW. Strings are quoted the standard way by doubling single
+// quotes, so the database must not treat backslashes in strings as escapes.
+func inlineArgs(query string, args []any) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	toks, err := scanSQL(query)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	last, n := 0, 0
+	for _, tok := range toks {
+		if tok.Kind != sqlPunct || tok.Text != "?" {
+			continue
+		}
+		if n >= len(args) {
+			return "", fmt.Errorf("missing argument %d", n+1)
+		}
+		sb.WriteString(query[last:tok.Offset])
+		sb.WriteString(sqlLiteral(args[n]))
+		last = tok.End
+		n++
+	}
+	if n < len(args) {
+		return "", fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), nil
+}
+
+// sqlLiteral formats a value as a SQL literal.
+func sqlLiteral(v any) string {
+	switch v := Normalize(v).(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+	}
+}
@@ -0,0 +1,38 @@
+package esqlo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindParams(t *testing.T) {
+	params := map[string]any{"user_id": "u1", "tenant": nil}
+	query, args, err := bindParams(`SELECT x::INT, ':user_id', read_csv('a.csv', header := true) FROM t WHERE owner = :user_id AND (t = :TENANT OR o = :other) AND y = :user_id`, params)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT x::INT, ':user_id', read_csv('a.csv', header := true) FROM t WHERE owner = ? AND (t = ? OR o = :other) AND y = ?`, query)
+	assert.Equal(t, []any{"u1", nil, "u1"}, args)
+
+	query, args, err = bindParams("SELECT a::user_id, b: user_id FROM t", params)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT a::user_id, b: user_id FROM t", query)
+	assert.Empty(t, args)
+
+	query, args, err = bindParams("SELECT * FROM t WHERE a = :Name AND b = :name", map[string]any{"Name": "x"})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = ? AND b = ?", query, "route parameters keep the case of the file name")
+	assert.Equal(t, []any{"x", "x"}, args)
+}
+
+func TestInlineArgs(t *testing.T) {
+	query, err := inlineArgs("CREATE TEMP VIEW v AS SELECT * FROM t WHERE a = ? AND b = ? AND c = ? AND d = ? AND e <> '?'",
+		[]any{"it's", nil, 42, true})
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TEMP VIEW v AS SELECT * FROM t WHERE a = 'it''s' AND b = NULL AND c = 42 AND d = TRUE AND e <> '?'", query)
+
+	_, err = inlineArgs("SELECT ?, ?", []any{1})
+	assert.EqualError(t, err, "missing argument 2")
+	_, err = inlineArgs("SELECT ?", []any{1, 2})
+	assert.EqualError(t, err, "expected 1 arguments, got 2")
+}
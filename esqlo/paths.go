@@ -0,0 +1,149 @@
+package esqlo
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fileDatabase is implemented by databases that read files named in queries, such as DuckDB. The Renderer
+// resolves relative paths in their queries, see Renderer.Dir.
+type fileDatabase interface {
+	readsFiles()
+}
+
+// fileFunctions are the table functions of DuckDB that read files.
+var fileFunctions = []string{"read_csv", "read_csv_auto", "read_parquet", "parquet_scan", "parquet_metadata",
+	"parquet_schema", "read_json", "read_json_auto", "read_ndjson", "read_ndjson_auto", "read_json_objects",
+	"read_json_objects_auto", "read_ndjson_objects", "read_text", "read_blob", "glob", "sniff_csv"}
+
+// pathKinds are the kinds of statements that take paths of files as string literals.
+var pathKinds = []string{"COPY", "ATTACH", "IMPORT", "EXPORT"}
+
+// fromEnd are the keywords that end the list of tables after FROM. The conditions of joins after ON and USING do
+// not end it, since more tables may follow them, e.g. FROM a JOIN b ON a.id = b.id, 'data.csv'.
+var fromEnd = []string{"WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "OFFSET", "QUALIFY", "WINDOW", "UNION",
+	"EXCEPT", "INTERSECT", "SELECT", "RETURNING", "SET", "VALUES", "SAMPLE"}
+
+// tableStart are the keywords that are followed by a table, e.g. FROM 'data.csv' or PIVOT 'data.csv' ON year.
+var tableStart = []string{"FROM", "JOIN", "PIVOT", "UNPIVOT", "PIVOT_WIDER", "PIVOT_LONGER"}
+
+// filePaths returns the tokens of a statement that name files: the string literals of the first argument of
+// file reading table functions, the tables after FROM, JOIN, PIVOT or UNPIVOT that are string literals or quoted
+// identifiers that look like files, e.g. FROM 'data.csv' or FROM "data.csv" but not FROM "people", and all
+// string literals of COPY, ATTACH, IMPORT and EXPORT statements. It also returns the names of the file reading
+// functions whose paths are not string literals, since they are only known when the query runs.
+func filePaths(stmt []sqlToken, kind string) (paths []sqlToken, dynamic []string) {
+	inFrom := []bool{false} // whether the tokens at each depth of parentheses are in a list of tables
+	for i, tok := range stmt {
+		depth := len(inFrom) - 1
+		name := strings.ToLower(tok.Text) // the name of functions, which may be quoted
+		if tok.Kind == sqlIdent {
+			name = strings.ToLower(tok.Value)
+		}
+		switch {
+		case tok.Kind == sqlPunct && tok.Text == "(":
+			inFrom = append(inFrom, false)
+		case tok.Kind == sqlPunct && tok.Text == ")":
+			if depth > 0 {
+				inFrom = inFrom[:depth]
+			}
+		case startsTable(tok):
+			inFrom[depth] = true
+		case tok.Kind == sqlWord && slices.Contains(fromEnd, strings.ToUpper(tok.Text)):
+			inFrom[depth] = false
+		case (tok.Kind == sqlWord || tok.Kind == sqlIdent) && slices.Contains(fileFunctions, name) &&
+			i+1 < len(stmt) && stmt[i+1].Text == "(":
+			args, ok := fileArgs(stmt[i+2:])
+			if !ok {
+				dynamic = append(dynamic, name)
+			}
+			paths = append(paths, args...)
+		case tok.Kind == sqlString && slices.Contains(pathKinds, kind),
+			(tok.Kind == sqlString || tok.Kind == sqlIdent && strings.ContainsAny(tok.Value, "./")) && inFrom[depth] &&
+				i > 0 && (startsTable(stmt[i-1]) || stmt[i-1].Text == ","):
+			paths = append(paths, tok)
+		}
+	}
+	return paths, dynamic
+}
+
+// startsTable reports whether a token is a keyword that is followed by a table, see tableStart.
+func startsTable(tok sqlToken) bool {
+	return tok.Kind == sqlWord && slices.Contains(tableStart, strings.ToUpper(tok.Text))
+}
+
+// fileArgs returns the string literals of the first argument of a call of a file reading function, starting
+// after its opening parenthesis. It reports false if the argument is not a string literal or a list of them.
+func fileArgs(args []sqlToken) ([]sqlToken, bool) {
+	var paths []sqlToken
+	list := len(args) > 0 && args[0].Text == "["
+	end := []string{",", ")"} // the tokens that may follow the argument
+	if list {
+		args = args[1:]
+		end = []string{",", "]"}
+	}
+	for i := 0; ; i += 2 {
+		if i+1 >= len(args) || args[i].Kind != sqlString || !slices.Contains(end, args[i+1].Text) {
+			return paths, false
+		}
+		paths = append(paths, args[i])
+		if args[i+1].Text == "]" && (i+2 >= len(args) || args[i+2].Text != "," && args[i+2].Text != ")") {
+			return paths, false
+		}
+		if args[i+1].Text != "," || !list {
+			return paths, true
+		}
+	}
+}
+
+// resolvePaths rewrites the relative paths of files in a query to absolute paths in dir, so a template can
+// query files next to it no matter the working directory of the server:
+//
+//	<sql src="duckdb" id="reviews">SELECT * FROM 'data/reviews.csv'</sql>
+//
+// reads data/reviews.csv in the directory of the template. Relative paths must stay inside root, e.g.
+// '../../secret.csv' is an error if it leaves root. Absolute paths, URLs and paths that are only known when
+// the query runs are left as they are.
+func resolvePaths(query, dir, root string) (string, error) {
+	toks, err := scanSQL(query)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, stmt := range splitStatements(toks) {
+		paths, _ := filePaths(stmt, statementKind(stmt))
+		for _, tok := range paths {
+			if !isRelativePath(tok) {
+				continue
+			}
+			path := filepath.Join(absDir, filepath.FromSlash(tok.Value))
+			if !isInside(path, absRoot) {
+				return "", fmt.Errorf("path %q is outside of the data directory %s: relative paths in queries are resolved against %s",
+					tok.Value, absRoot, absDir)
+			}
+			sb.WriteString(query[last:tok.Offset])
+			sb.WriteString("'" + strings.ReplaceAll(path, "'", "''") + "'")
+			last = tok.End
+		}
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), nil
+}
+
+// isRelativePath reports whether a token of filePaths is a relative path of a local file.
+func isRelativePath(tok sqlToken) bool {
+	path := tok.Value
+	return path != "" && !filepath.IsAbs(path) && !strings.HasPrefix(path, "~") && !strings.Contains(path, "://")
+}
@@ -0,0 +1,47 @@
+package esqlo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePaths(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	dir := filepath.Join(root, "pages")
+
+	tests := []struct {
+		query, resolved string
+	}{
+		{"SELECT * FROM 'people.csv'", "SELECT * FROM '" + dir + "/people.csv'"},
+		{`SELECT * FROM "../people.csv" p JOIN read_json(['a.json', 'b''s.json'], format = 'auto') j ON p.id = j.id`,
+			"SELECT * FROM '" + root + "/people.csv' p JOIN read_json(['" + dir + "/a.json', '" + dir + "/b''s.json'], format = 'auto') j ON p.id = j.id"},
+		{"SELECT * FROM people WHERE name = 'x.csv'; FROM \"people\"", "SELECT * FROM people WHERE name = 'x.csv'; FROM \"people\""},
+		{"SELECT * FROM '/data/x.csv', 's3://bucket/x.csv', '~/x.csv'", "SELECT * FROM '/data/x.csv', 's3://bucket/x.csv', '~/x.csv'"},
+		{"COPY people TO 'out.csv'", "COPY people TO '" + dir + "/out.csv'"},
+		{"SELECT * FROM a JOIN b ON a.id = b.id, 'c.csv'", "SELECT * FROM a JOIN b ON a.id = b.id, '" + dir + "/c.csv'"},
+		{"SELECT * FROM a JOIN b USING (id), 'c.csv'", "SELECT * FROM a JOIN b USING (id), '" + dir + "/c.csv'"},
+		{"SELECT * FROM (PIVOT 'sales.csv' ON year USING sum(total))", "SELECT * FROM (PIVOT '" + dir + "/sales.csv' ON year USING sum(total))"},
+		{"UNPIVOT 'sales.csv' ON COLUMNS(*) INTO NAME k VALUE v", "UNPIVOT '" + dir + "/sales.csv' ON COLUMNS(*) INTO NAME k VALUE v"},
+	}
+	for _, test := range tests {
+		resolved, err := resolvePaths(test.query, dir, root)
+		require.NoError(t, err, test.query)
+		assert.Equal(t, test.resolved, resolved, test.query)
+	}
+
+	for _, query := range []string{
+		"SELECT * FROM read_csv('../../secret.csv')",
+		"SELECT * FROM a JOIN b ON true, '../../secret.csv'",
+		"SELECT * FROM a JOIN b USING (id), '../../secret.csv'",
+		"SELECT * FROM (PIVOT '../../secret.csv' ON k USING first(v))",
+		"SELECT * FROM (UNPIVOT '../../secret.csv' ON COLUMNS(*) INTO NAME k VALUE v)",
+	} {
+		_, err = resolvePaths(query, dir, root)
+		assert.EqualError(t, err, `path "../../secret.csv" is outside of the data directory `+root+
+			`: relative paths in queries are resolved against `+dir, query)
+	}
+}
@@ -0,0 +1,223 @@
+package esqlo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy restricts the queries that templates can run against a source. Since the body of a sql tag is
+// arbitrary SQL, a template could otherwise write to a database, load extensions or read any file the server
+// can read, e.g. SELECT * FROM read_csv('/etc/passwd').
+//
+// Policies are checked by scanning the query before it runs, see CheckQuery. The scan understands the quoting
+// and comments of SQL, but it is no full parser: use the settings of the database, such as the read only
+// access mode of a DuckDB file, as a second line of defense where possible.
+type Policy struct {
+	// ReadOnly allows only statements that read data: SELECT (including VALUES, TABLE and WITH queries),
+	// DESCRIBE, SHOW, SUMMARIZE and EXPLAIN.
+	ReadOnly bool `yaml:"read_only"`
+
+	// Allow lists the kinds of statements that may run, e.g. [SELECT], or all if empty.
+	Allow []string `yaml:"allow"`
+
+	// Settings are passed to the database when it is opened, e.g. enable_external_access: "false" for DuckDB.
+	// Queries cannot change settings with SET, RESET or PRAGMA if a policy has any.
+	Settings map[string]string `yaml:"settings"`
+
+	// Sandbox restricts the files that queries can read or write to the Root of the Renderer: the paths of
+	// file reading table functions such as read_csv, of files queried directly like FROM 'data.csv' and of
+	// COPY, ATTACH, IMPORT and EXPORT statements. Extensions cannot be installed or loaded in the sandbox.
+	Sandbox bool `yaml:"sandbox"`
+
+	// Setup statements run before the queries of each page in a session of their own, with the parameters of
+	// the page such as :user_id and :tenant_id. They can restrict the data to the user of the page, e.g.
+	// CREATE TEMP VIEW orders AS SELECT * FROM main.orders WHERE tenant = :tenant_id. The database must
+	// implement Sessioner. Setup statements are not checked against the rest of the policy.
+	Setup []string `yaml:"setup"`
+}
+
+// AnyPolicy is the name of the policy of sources without a policy of their own.
+const AnyPolicy = "*"
+
+// LoadPolicies reads policies from YAML, keyed by the src of the tags they apply to or by the name of a
+// driver:
+//
+//	duckdb:
+//	  read_only: true
+//	  sandbox: true
+//	duckdb://warehouse.db:
+//	  allow: [SELECT]
+//	  settings:
+//	    access_mode: READ_ONLY
+//	"*":
+//	  read_only: true
+func LoadPolicies(r io.Reader) (map[string]*Policy, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var policies map[string]*Policy
+	if err := dec.Decode(&policies); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for name, p := range policies {
+		if p == nil {
+			return nil, fmt.Errorf("policy %q is empty", name)
+		}
+		for i, kind := range p.Allow {
+			p.Allow[i] = strings.ToUpper(kind)
+		}
+	}
+	return policies, nil
+}
+
+// policy returns the policy of a src: the policy of the src itself, else the policy of its driver, else the
+// policy of any source. It returns nil if there is none.
+func (r *Renderer) policy(src *url.URL) *Policy {
+	if p, ok := r.Policies[src.String()]; ok {
+		return p
+	}
+	name := src.Scheme
+	if name == "" {
+		name = src.Path
+	}
+	if p, ok := r.Policies[name]; ok {
+		return p
+	}
+	return r.Policies[AnyPolicy]
+}
+
+// applySettings adds the settings of a policy to the options in the query of src. The settings of the policy
+// win over the options of the src, and a src cannot set options of its own if the policy is read only or a
+// sandbox, so a template cannot loosen the settings of the server.
+func (p *Policy) applySettings(src *url.URL) error {
+	if (p.ReadOnly || p.Sandbox) && src.RawQuery != "" {
+		return fmt.Errorf("the policy of this source does not allow options in src, got %q", src.RawQuery)
+	}
+	if len(p.Settings) == 0 {
+		return nil
+	}
+	q := src.Query()
+	for k, v := range p.Settings {
+		q.Set(k, v)
+	}
+	src.RawQuery = q.Encode()
+	return nil
+}
+
+// readKinds are the kinds of statements allowed by read only policies.
+var readKinds = []string{"SELECT", "DESCRIBE", "SHOW", "SUMMARIZE", "EXPLAIN"}
+
+// writeKeywords start statements that write, which are rejected anywhere in a query by read only policies,
+// e.g. in the common table expressions of a WITH query.
+var writeKeywords = []string{"INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE", "COPY", "ATTACH", "DETACH",
+	"CREATE", "DROP", "ALTER", "IMPORT", "EXPORT", "INSTALL", "LOAD", "CHECKPOINT", "VACUUM"}
+
+// settingKinds are the kinds of statements that change settings.
+var settingKinds = []string{"SET", "RESET", "PRAGMA"}
+
+// CheckQuery returns an error if the policy does not allow the query. A sandbox restricts files to root, and
+// relative paths are resolved against the working directory like the database does.
+func (p *Policy) CheckQuery(query string, root string) error {
+	toks, err := scanSQL(query)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(toks) {
+		kind := statementKind(stmt)
+		if len(p.Allow) > 0 && !slices.Contains(p.Allow, kind) {
+			return fmt.Errorf("%s statements are not allowed by the policy of this source (allowed: %s)",
+				kind, strings.Join(p.Allow, ", "))
+		}
+		if p.ReadOnly {
+			if !slices.Contains(readKinds, kind) {
+				return fmt.Errorf("%s statements are not allowed, the source is read only", kind)
+			}
+			for _, tok := range stmt {
+				if tok.Kind == sqlWord && slices.Contains(writeKeywords, strings.ToUpper(tok.Text)) {
+					return fmt.Errorf("%s is not allowed, the source is read only", strings.ToUpper(tok.Text))
+				}
+			}
+		}
+		if len(p.Settings) > 0 && slices.Contains(settingKinds, kind) {
+			return fmt.Errorf("%s statements are not allowed, the policy of this source sets the settings", kind)
+		}
+		if p.Sandbox {
+			if err := checkSandbox(stmt, kind, root); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkSandbox returns an error if a statement uses a file outside of root or loads extensions.
+func checkSandbox(stmt []sqlToken, kind, root string) error {
+	if kind == "INSTALL" || kind == "LOAD" {
+		return fmt.Errorf("%s statements are not allowed in the sandbox", kind)
+	}
+	paths, dynamic := filePaths(stmt, kind)
+	if len(dynamic) > 0 {
+		return fmt.Errorf("the sandbox only allows string literals as paths of %s", dynamic[0])
+	}
+	for _, tok := range paths {
+		if err := checkPath(tok.Value, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPath returns an error if path is not inside root after following symbolic links. URLs like
+// s3://bucket/file are never inside root.
+func checkPath(path, root string) error {
+	if strings.Contains(path, "://") {
+		return fmt.Errorf("the sandbox does not allow reading %q: only files inside the served directory are allowed", path)
+	}
+	absRoot, err := resolvePath(root)
+	if err != nil {
+		return fmt.Errorf("resolving sandbox root: %w", err)
+	}
+	abs, err := resolvePath(path)
+	if err != nil {
+		return fmt.Errorf("resolving %q: %w", path, err)
+	}
+	if !isInside(abs, absRoot) {
+		return fmt.Errorf("the sandbox does not allow reading %q: it is outside of the served directory", path)
+	}
+	return nil
+}
+
+// isInside reports whether the absolute path is root or inside of it.
+func isInside(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute path of path with symbolic links resolved, as far as the file exists.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if errors.Is(err, fs.ErrNotExist) {
+		// resolve the parent, e.g. of a file to write or a glob pattern
+		dir, file := filepath.Split(abs)
+		if dir == abs || file == "" {
+			return abs, nil
+		}
+		parent, err := resolvePath(filepath.Clean(dir))
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(parent, file), nil
+	}
+	return resolved, err
+}
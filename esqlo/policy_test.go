@@ -0,0 +1,115 @@
+package esqlo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPolicies(t *testing.T) {
+	policies, err := LoadPolicies(strings.NewReader(`
+duckdb:
+  read_only: true
+  allow: [select, describe]
+  settings:
+    enable_external_access: "false"
+"*":
+  sandbox: true
+`))
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{ReadOnly: true, Allow: []string{"SELECT", "DESCRIBE"},
+		Settings: map[string]string{"enable_external_access": "false"}}, policies["duckdb"])
+	assert.Equal(t, &Policy{Sandbox: true}, policies[AnyPolicy])
+
+	_, err = LoadPolicies(strings.NewReader("duckdb:\n  readonly: true\n"))
+	assert.ErrorContains(t, err, "field readonly not found")
+}
+
+func TestCheckQuery(t *testing.T) {
+	readOnly := &Policy{ReadOnly: true}
+	for _, query := range []string{
+		"SELECT * FROM t; DESCRIBE t",
+		"WITH a AS (SELECT 1) SELECT * FROM a",
+		"SELECT 'DELETE FROM t' AS \"insert\" -- DROP TABLE t",
+	} {
+		assert.NoError(t, readOnly.CheckQuery(query, ""), query)
+	}
+	assert.EqualError(t, readOnly.CheckQuery("SELECT 1; DROP TABLE t", ""), "DROP statements are not allowed, the source is read only")
+	assert.EqualError(t, readOnly.CheckQuery("WITH a AS (DELETE FROM t RETURNING *) SELECT * FROM a", ""), "DELETE is not allowed, the source is read only")
+	assert.EqualError(t, readOnly.CheckQuery("COPY (SELECT 1) TO 'out.csv'", ""), "COPY statements are not allowed, the source is read only")
+
+	allow := &Policy{Allow: []string{"SELECT"}}
+	assert.NoError(t, allow.CheckQuery("FROM t", ""))
+	assert.EqualError(t, allow.CheckQuery("SHOW TABLES", ""), "SHOW statements are not allowed by the policy of this source (allowed: SELECT)")
+
+	settings := &Policy{Settings: map[string]string{"enable_external_access": "false"}}
+	assert.EqualError(t, settings.CheckQuery("SET enable_external_access = true", ""), "SET statements are not allowed, the policy of this source sets the settings")
+}
+
+func TestSandbox(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.csv"), []byte("a\n1\n"), 0o644))
+	require.NoError(t, os.Symlink("/etc", filepath.Join(root, "etc")))
+	inRoot := func(name string) string { return filepath.Join(root, name) }
+
+	sandbox := &Policy{Sandbox: true}
+	for _, query := range []string{
+		"SELECT * FROM '" + inRoot("data.csv") + "'",
+		"SELECT * FROM read_csv('" + inRoot("data.csv") + "', header = true)",
+		"SELECT * FROM read_csv(['" + inRoot("data.csv") + "', '" + inRoot("more/*.csv") + "'])",
+		"SELECT * FROM t WHERE name = '/etc/passwd'",
+		"COPY t TO '" + inRoot("out.csv") + "'",
+		`SELECT name FROM "people" JOIN "orders" ON true`, // quoted tables are not files
+	} {
+		assert.NoError(t, sandbox.CheckQuery(query, root), query)
+	}
+
+	outside := `the sandbox does not allow reading "%s": it is outside of the served directory`
+	for query, path := range map[string]string{
+		"SELECT * FROM read_csv('/etc/passwd')":                                             "/etc/passwd",
+		"SELECT * FROM \"READ_CSV_AUTO\"('/etc/passwd')":                                    "/etc/passwd",
+		"SELECT * FROM '" + inRoot("../secret.csv") + "'":                                   inRoot("../secret.csv"),
+		"SELECT * FROM '" + inRoot("etc/passwd") + "'":                                      inRoot("etc/passwd"),
+		"SELECT * FROM t JOIN '/etc/passwd' ON true":                                        "/etc/passwd",
+		"SELECT * FROM t, (SELECT 1), \"/etc/passwd\"":                                      "/etc/passwd",
+		"SELECT * FROM glob('/etc/*')":                                                      "/etc/*",
+		"ATTACH '/var/lib/db.duckdb' AS other":                                              "/var/lib/db.duckdb",
+		"SELECT * FROM read_parquet(['" + inRoot("a") + "', '/etc/x'])":                     "/etc/x",
+		"SELECT * FROM (SELECT 1 AS a) t1 JOIN (SELECT 1 AS a) t2 ON true, '/etc/passwd'":   "/etc/passwd",
+		"SELECT * FROM (SELECT 1 AS a) t1 JOIN (SELECT 1 AS a) t2 USING (a), '/etc/passwd'": "/etc/passwd",
+		"SELECT * FROM (PIVOT '/etc/x.csv' ON secret USING first(val))":                     "/etc/x.csv",
+		"SELECT * FROM (UNPIVOT '/etc/x.csv' ON COLUMNS(*) INTO NAME k VALUE v)":            "/etc/x.csv",
+	} {
+		assert.EqualError(t, sandbox.CheckQuery(query, root), strings.ReplaceAll(outside, "%s", path), query)
+	}
+
+	assert.EqualError(t, sandbox.CheckQuery("SELECT * FROM read_csv('s3://bucket/x.csv')", root),
+		`the sandbox does not allow reading "s3://bucket/x.csv": only files inside the served directory are allowed`)
+	assert.EqualError(t, sandbox.CheckQuery("SELECT * FROM read_csv('/et' || 'c/passwd')", root),
+		"the sandbox only allows string literals as paths of read_csv")
+	assert.EqualError(t, sandbox.CheckQuery("SELECT * FROM read_csv(['a.csv'] || ['/etc/passwd'])", root),
+		"the sandbox only allows string literals as paths of read_csv")
+	assert.EqualError(t, sandbox.CheckQuery("INSTALL httpfs", root), "INSTALL statements are not allowed in the sandbox")
+}
+
+func TestRenderPolicy(t *testing.T) {
+	RegisterDriver("policytest", func() Database { return &MemDB{} })
+	defer delete(drivers, "policytest")
+
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = itemsDb
+	renderer.Policies = map[string]*Policy{AnyPolicy: {ReadOnly: true}}
+	var out bytes.Buffer
+	err := renderer.RenderHTML(strings.NewReader(`<sql id="items">DELETE FROM items</sql>{{#items}}{{id}}{{/items}}`), &out)
+	assert.EqualError(t, err, "[1:17] query not allowed: DELETE statements are not allowed, the source is read only")
+
+	renderer = NewRenderer()
+	renderer.Policies = map[string]*Policy{"policytest": {ReadOnly: true}}
+	err = renderer.RenderHTML(strings.NewReader(`<sql id="items" src="policytest://data?threads=1">SELECT 1</sql>`), &out)
+	assert.EqualError(t, err, `[1:1] loading database: the policy of this source does not allow options in src, got "threads=1"`)
+}
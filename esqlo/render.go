@@ -2,10 +2,16 @@ package esqlo
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/masp/esqlo/esqlo/mustache"
 	"github.com/rs/zerolog/log"
@@ -13,13 +19,25 @@ import (
 )
 
 type SqlTag struct {
-	Offset, End int      // the offset in the source file where this tag starts
-	Src         string   // the database connection to use
-	Database    Database // the database connection to use
-	TableName   string   // the name to store this table as
+	Start       int           // the offset in the source file of the start tag <sql ...>
+	Offset, End int           // the offset in the source file where this tag starts
+	Src         string        // the database connection to use
+	Database    Database      // the database connection to use
+	TableName   string        // the name to store this table as
+	GroupBy     []string      // columns to group the rows by, see GroupRows
+	Nest        string        // name of the list of rows in each group
+	JSONColumns []string      // text columns holding JSON to decode, see DecodeJSONColumns
+	Paginate    int           // the number of rows per page, 0 if the result is not paginated
+	NoTotal     bool          // do not count the rows of all pages of a paginated result
+	Timeout     time.Duration // the maximum duration of the query, overrides Renderer.Timeout if not 0
+	MaxRows     int           // the maximum number of rows of the result, 0 for the limits of the Renderer only
+	Policy      *Policy       // the policy of the source, nil if the source has none
+	Routes      bool          // the rows are the parameters of the pages of a dynamic route, see Handler.Build
 
-	Query  string  // the sql query to execute
-	Result *Result // the result of the query
+	Query    string        // the sql query to execute
+	Args     []any         // the values of the ? placeholders of Query, see Renderer.Params
+	Result   *Result       // the result of the query
+	Duration time.Duration // how long the query took, including counting the rows of a paginated result
 }
 
 type Err struct {
@@ -34,12 +52,80 @@ func (e *Err) Error() string {
 type Renderer struct {
 	Databases map[string]Database
 	Errors    []*Err // any errors that occurred while processing the document (can be ignored gracefully)
+	Warnings  []*Err // problems that did not prevent rendering the document, such as truncated results
+
+	// Strict records an error for every mustache variable or section that cannot be resolved. A page can also
+	// opt in by itself with <meta name="esqlo" content="strict">.
+	Strict bool
+
+	// URL is the URL of the request for the rendered page, if any. Its query selects the page of paginated
+	// sql tags.
+	URL *url.URL
+
+	// Timeout is the maximum duration of each query that has no timeout attribute, 0 for no limit.
+	Timeout time.Duration
+
+	// Limits of the results of each query and of all queries of the page together, 0 for no limit. Results
+	// are truncated to the limits, see QueryOptions. The max-rows attribute of a tag can only lower MaxRows.
+	MaxRows      int
+	MaxBytes     int64
+	MaxPageRows  int
+	MaxPageBytes int64
+
+	// Policies restrict the queries of sources, keyed by the src of tags, the name of a driver or AnyPolicy,
+	// see Policy.
+	Policies map[string]*Policy
+
+	// User is the authenticated user of the request for the rendered page, if any. Templates can refer to it
+	// as {{user.name}}, see User.
+	User *User
+
+	// Params are the values of named parameters in queries, e.g. :user_id. They are passed to the database as
+	// arguments of the query, never as part of its text. Templates can refer to them as {{params.user_id}}.
+	Params map[string]any
+
+	// RoutesOnly runs only the sql tags with the routes attribute, which are skipped otherwise, see Routes.
+	RoutesOnly bool
+
+	// Check checks the document without running its queries: databases that implement Describer check the
+	// queries instead, and each result gets a row of placeholder values. Every branch of the template is then
+	// rendered once, so every variable is checked against the columns of the results. The output is not
+	// meaningful. See Handler.Check.
+	Check bool
+
+	// Partials is the directory that partials like {{> partials/header}} are loaded from, the working directory
+	// if empty. Partials are mustache templates, e.g. partials/header.mustache, and cannot have sql tags.
+	Partials string
+
+	// Root is the directory that sandboxed policies restrict files to, the working directory if empty.
+	Root string
+
+	// Dir is the directory that relative paths of files in queries of databases such as DuckDB resolve
+	// against, usually the directory of the template. Relative paths must not leave Root (or Dir if Root is
+	// empty). If Dir is empty, relative paths are left to the database, which resolves them against the working
+	// directory.
+	Dir string
 
 	lc           *LineCounter
+	srcmap       []span    // maps offsets in the stripped document (without <sql> tags) back to the source document
+	outOffset    int       // current offset in the stripped document
 	allSqlTags   []*SqlTag // all sql tags in the document, irregardless of scope, in order of appearance
 	activeSqlTag *SqlTag   // the sql tag that is currently being tokenized (nil if not in one)
 
-	context map[string]any // the context to use when rendering mustache tags
+	ctx     context.Context // canceled when the rendered page is no longer needed, e.g. the client is gone
+	context map[string]any  // the context to use when rendering mustache tags
+	mem     *MemDB          // the implicit database of this page, holding the result of every loaded sql tag
+
+	dbs      map[string]Database // the databases opened for the sources of the page, closed when it is rendered
+	sessions map[string]Database // the sessions of the sources with setup statements, see Policy.Setup
+
+	pageRows  int   // the number of rows loaded by all sql tags so far, see MaxPageRows
+	pageBytes int64 // the size of the rows loaded by all sql tags so far, see MaxPageBytes
+}
+
+// span records that the stripped document starting at out was copied from the source document at src.
+type span struct {
+	out, src int
 }
 
 func NewRenderer() *Renderer {
@@ -49,6 +135,13 @@ func NewRenderer() *Renderer {
 	}
 }
 
+func (r *Renderer) warnf(offset int, format string, args ...interface{}) {
+	l, c := r.lc.LineCol(offset)
+	w := &Err{Line: l, Col: c, Msg: fmt.Errorf(format, args...)}
+	log.Warn().Msg(w.Error())
+	r.Warnings = append(r.Warnings, w)
+}
+
 func (r *Renderer) errorf(offset int, format string, args ...interface{}) {
 	l, c := r.lc.LineCol(offset)
 	r.Errors = append(r.Errors, &Err{
@@ -58,6 +151,17 @@ func (r *Renderer) errorf(offset int, format string, args ...interface{}) {
 	})
 }
 
+// srcOffset converts an offset in the stripped document that is passed to mustache back into an offset in the
+// source document, accounting for the removed <sql> tags.
+func (r *Renderer) srcOffset(out int) int {
+	i := sort.Search(len(r.srcmap), func(i int) bool { return r.srcmap[i].out > out })
+	if i == 0 {
+		return out
+	}
+	s := r.srcmap[i-1]
+	return s.src + (out - s.out)
+}
+
 func (r *Renderer) errlist() error {
 	if len(r.Errors) == 0 {
 		return nil
@@ -87,9 +191,23 @@ func (r *Renderer) errlist() error {
 //
 // Replacement values are injected into the HTML document afterwards using the Mustache template syntax.
 func (r *Renderer) RenderHTML(src io.Reader, w io.Writer) error {
+	return r.RenderHTMLContext(context.Background(), src, w)
+}
+
+// RenderHTMLContext is like RenderHTML but stops running queries when ctx is canceled, e.g. with the context of
+// the HTTP request for the page.
+func (r *Renderer) RenderHTMLContext(ctx context.Context, src io.Reader, w io.Writer) error {
+	r.ctx = ctx
+	if r.User != nil {
+		r.context["user"] = r.User
+	}
+	if r.Params != nil {
+		r.context["params"] = r.Params
+	}
 	var buf bytes.Buffer
 	r.walkTokens(src, &buf)
 	r.renderMustache(buf.String(), w)
+	r.close()
 	return r.errlist()
 }
 
@@ -105,12 +223,14 @@ func (r *Renderer) walkTokens(src io.Reader, w io.Writer) {
 		case html.ErrorToken:
 			err := z.Err()
 			if err == io.EOF {
-				err = nil
+				if r.activeSqlTag != nil {
+					r.errorf(r.activeSqlTag.Offset, "unclosed sql tag, expected </sql>")
+				}
 				return
 			} else if err != nil {
 				r.errorf(p, err.Error())
 			}
-			r.render(w, z.Raw())
+			r.render(w, p, z.Raw())
 		case html.StartTagToken:
 			tn, hasAttr := z.TagName()
 			if bytes.Equal(tn, []byte("sql")) {
@@ -118,7 +238,7 @@ func (r *Renderer) walkTokens(src io.Reader, w io.Writer) {
 					r.errorf(p, "nested sql tags are not allowed")
 				}
 
-				r.activeSqlTag = &SqlTag{Offset: offset}
+				r.activeSqlTag = &SqlTag{Start: p, Offset: offset}
 				if hasAttr {
 					for {
 						k, v, more := z.TagAttr()
@@ -126,6 +246,34 @@ func (r *Renderer) walkTokens(src io.Reader, w io.Writer) {
 							r.activeSqlTag.Src = string(v)
 						} else if bytes.Equal(k, []byte("id")) {
 							r.activeSqlTag.TableName = string(v)
+						} else if bytes.Equal(k, []byte("group-by")) {
+							r.activeSqlTag.GroupBy = parseColumnList(string(v))
+						} else if bytes.Equal(k, []byte("nest")) {
+							r.activeSqlTag.Nest = string(v)
+						} else if bytes.Equal(k, []byte("json-columns")) {
+							r.activeSqlTag.JSONColumns = parseColumnList(string(v))
+						} else if bytes.Equal(k, []byte("paginate")) {
+							size, err := parsePageSize(string(v))
+							if err != nil {
+								r.errorf(p, "%v", err)
+							}
+							r.activeSqlTag.Paginate = size
+						} else if bytes.Equal(k, []byte("routes")) {
+							r.activeSqlTag.Routes = true
+						} else if bytes.Equal(k, []byte("total")) {
+							r.activeSqlTag.NoTotal = string(v) == "false"
+						} else if bytes.Equal(k, []byte("max-rows")) {
+							n, err := strconv.Atoi(string(v))
+							if err != nil || n <= 0 {
+								r.errorf(p, "max-rows must be a positive number, got %q", v)
+							}
+							r.activeSqlTag.MaxRows = n
+						} else if bytes.Equal(k, []byte("timeout")) {
+							timeout, err := time.ParseDuration(string(v))
+							if err != nil || timeout <= 0 {
+								r.errorf(p, "timeout must be a positive duration like 2s or 500ms, got %q", v)
+							}
+							r.activeSqlTag.Timeout = timeout
 						}
 						if !more {
 							break
@@ -144,29 +292,50 @@ func (r *Renderer) walkTokens(src io.Reader, w io.Writer) {
 					continue
 				}
 
-				tag.Database, err = r.LoadDatabase(srcUrl)
+				if tag.Policy = r.policy(srcUrl); tag.Policy != nil {
+					if err := tag.Policy.applySettings(srcUrl); err != nil {
+						r.errorf(p, "loading database: %v", err)
+						continue
+					}
+				}
+
+				tag.Database, err = r.open(tag.Src, srcUrl)
 				if err != nil {
 					r.errorf(p, "loading database: %w", err)
 					continue
 				}
+				if tag.Policy != nil && len(tag.Policy.Setup) > 0 && tag.Src != ImplicitDb {
+					tag.Database, err = r.session(tag.Src, tag.Database, tag.Policy.Setup)
+					if err != nil {
+						r.errorf(p, "setting up session: %v", err)
+						continue
+					}
+				}
 
 				if r.activeSqlTag.TableName == "" {
 					r.errorf(p, "missing required 'id' attribute")
 				}
 			} else {
-				r.render(w, z.Raw())
+				if hasAttr && bytes.Equal(tn, []byte("meta")) {
+					r.readMeta(z)
+				}
+				r.render(w, p, z.Raw())
 			}
 		case html.TextToken:
 			if r.activeSqlTag != nil {
 				r.activeSqlTag.Query += string(z.Raw())
 			} else {
-				r.render(w, z.Raw())
+				r.render(w, p, z.Raw())
 			}
 		case html.SelfClosingTagToken:
-			if z.Token().Data == "sql" {
+			tn, hasAttr := z.TagName()
+			if bytes.Equal(tn, []byte("sql")) {
 				continue // ignore
 			} else {
-				r.render(w, z.Raw())
+				if hasAttr && bytes.Equal(tn, []byte("meta")) {
+					r.readMeta(z)
+				}
+				r.render(w, p, z.Raw())
 			}
 		case html.EndTagToken:
 			if z.Token().Data == "sql" {
@@ -178,48 +347,440 @@ func (r *Renderer) walkTokens(src io.Reader, w io.Writer) {
 				r.loadSql(r.activeSqlTag)
 				r.activeSqlTag = nil
 			} else {
-				r.render(w, z.Raw())
+				r.render(w, p, z.Raw())
 			}
 		case html.CommentToken, html.DoctypeToken:
 			if r.activeSqlTag == nil {
-				r.render(w, z.Raw())
+				r.render(w, p, z.Raw())
 			}
 		}
 	}
 }
 
-func (r *Renderer) render(w io.Writer, src []byte) {
+// readMeta reads page options from a <meta name="esqlo" content="..."> tag. The content is a comma-separated
+// list of options.
+func (r *Renderer) readMeta(z *html.Tokenizer) {
+	var name, content string
+	for {
+		k, v, more := z.TagAttr()
+		if bytes.Equal(k, []byte("name")) {
+			name = string(v)
+		} else if bytes.Equal(k, []byte("content")) {
+			content = string(v)
+		}
+		if !more {
+			break
+		}
+	}
+	if name != "esqlo" {
+		return
+	}
+	for _, opt := range strings.Split(content, ",") {
+		switch strings.TrimSpace(opt) {
+		case "strict":
+			r.Strict = true
+		}
+	}
+}
+
+func (r *Renderer) render(w io.Writer, offset int, src []byte) {
+	if n := len(r.srcmap); n == 0 || r.srcmap[n-1].src+(r.outOffset-r.srcmap[n-1].out) != offset {
+		r.srcmap = append(r.srcmap, span{out: r.outOffset, src: offset})
+	}
+	r.outOffset += len(src)
 	w.Write(src)
 }
 
 func (r *Renderer) renderMustache(src string, w io.Writer) {
-	w.Write([]byte(mustache.Render(src, r.context)))
+	var tmpl *mustache.Template
+	var err error
+	if r.Partials != "" {
+		tmpl, err = mustache.ParseStringIn(src, r.Partials)
+	} else {
+		tmpl, err = mustache.ParseString(src)
+	}
+	var perr *mustache.ParseError
+	if errors.As(err, &perr) {
+		r.errorf(r.srcOffset(perr.Offset), "%s", perr.Message)
+	} else if err != nil {
+		r.errorf(0, "%v", err)
+	}
+	var errs []*mustache.RenderError
+	if r.Check {
+		errs = tmpl.Check(r.context)
+	} else {
+		errs = tmpl.Execute(w, r.Strict, r.context)
+	}
+	seen := make(map[int]bool) // tags inside sections are rendered once per row, only report them once
+	for _, rerr := range errs {
+		if seen[rerr.Offset] {
+			continue
+		}
+		seen[rerr.Offset] = true
+		msg := rerr.Message
+		if rerr.Unresolved {
+			if s := r.suggest(rerr.Name); s != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+		}
+		r.errorf(r.srcOffset(rerr.Offset), "%s", msg)
+	}
+}
+
+// suggest returns the table or column name of the loaded tables that is closest to the unresolved name, or
+// the empty string if nothing is close enough.
+func (r *Renderer) suggest(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+
+	best, bestDist := "", max(2, len(name)/3+1)
+	try := func(candidate string) {
+		if d := editDistance(name, candidate); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	for _, tag := range r.allSqlTags {
+		try(tag.TableName)
+		if tag.Result != nil {
+			for _, col := range tag.Result.Columns {
+				try(col)
+			}
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and transpositions of adjacent
+// characters required to turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
 }
 
 func (r *Renderer) LoadDatabase(path *url.URL) (Database, error) {
 	if path.Path == ImplicitDb {
-		return r.Databases[ImplicitDb], nil
+		if base := r.Databases[ImplicitDb]; base != nil {
+			if _, ok := base.(*MemDB); !ok {
+				return base, nil
+			}
+		}
+		return r.implicitDb(), nil
 	}
 
-	if path.Path == "duckdb" || path.Scheme == "duckdb" {
-		db := &DuckDB{}
-		return db, db.OpenConnection(path)
+	name := path.Scheme
+	if name == "" {
+		name = path.Path
+	}
+	newDb, ok := drivers[name]
+	if !ok {
+		if name == "duckdb" {
+			return nil, fmt.Errorf("unknown database: %s (duckdb requires a build with CGO enabled)", path)
+		}
+		return nil, fmt.Errorf("unknown database: %s", path)
 	}
-	return nil, fmt.Errorf("unknown database: %s", path)
+	db := newDb()
+	return db, db.OpenConnection(path)
+}
+
+// open returns the database of the source src of the page, which is opened on first use so that all tags of a
+// source share one connection. The databases are closed when the page is rendered, see close.
+func (r *Renderer) open(src string, path *url.URL) (Database, error) {
+	if path.Path == ImplicitDb {
+		return r.LoadDatabase(path)
+	}
+	if db, ok := r.dbs[src]; ok {
+		return db, nil
+	}
+	db, err := r.LoadDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.dbs == nil {
+		r.dbs = make(map[string]Database)
+	}
+	r.dbs[src] = db
+	return db, nil
+}
+
+// close closes the sessions and databases that the page opened.
+func (r *Renderer) close() {
+	for src, s := range r.sessions {
+		if err := s.Close(); err != nil {
+			log.Warn().Msgf("closing session of %s: %v", src, err)
+		}
+	}
+	for src, db := range r.dbs {
+		if err := db.Close(); err != nil {
+			log.Warn().Msgf("closing database of %s: %v", src, err)
+		}
+	}
+	r.sessions, r.dbs = nil, nil
+}
+
+// implicitDb returns the in-memory database of the page. It starts with the tables of the MemDB configured as
+// ImplicitDb (if any) and every loaded sql tag adds its result as a table, so later tags can query the results
+// of earlier ones regardless of where they came from:
+//
+//	<sql src="duckdb" id="reviews">SELECT * FROM 'reviews.csv'</sql>
+//	<sql id="top">SELECT * FROM reviews WHERE stars > 3</sql>
+//
+// Any other database configured as ImplicitDb is queried as it is by sql tags without a src, which then cannot
+// query the results of earlier tags.
+func (r *Renderer) implicitDb() *MemDB {
+	if r.mem == nil {
+		if base, ok := r.Databases[ImplicitDb].(*MemDB); ok {
+			r.mem = base.clone()
+		} else {
+			r.mem = &MemDB{Tables: make(map[string]*MemTable)}
+		}
+	}
+	return r.mem
+}
+
+// Tags returns the sql tags of the document that were loaded, in order of appearance.
+func (r *Renderer) Tags() []*SqlTag {
+	return r.allSqlTags
+}
+
+// Routes returns the rows of the first sql tag with the routes attribute, which list the parameters of the
+// pages of a dynamic route. It returns nil if there is no such tag.
+func (r *Renderer) Routes() []any {
+	for _, tag := range r.allSqlTags {
+		if tag.Routes && tag.Result != nil {
+			return tag.Result.Rows
+		}
+	}
+	return nil
+}
+
+// session returns the session of the page with the source src, which runs the setup statements on first use.
+func (r *Renderer) session(src string, db Database, setup []string) (Database, error) {
+	if s, ok := r.sessions[src]; ok {
+		return s, nil
+	}
+	sessioner, ok := db.(Sessioner)
+	if !ok {
+		return nil, fmt.Errorf("the database of %s does not support setup statements", src)
+	}
+	stmts := make([]Statement, len(setup))
+	for i, query := range setup {
+		query, args, err := bindParams(query, r.Params)
+		if err != nil {
+			return nil, err
+		}
+		stmts[i] = Statement{Query: query, Args: args}
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s, err := sessioner.Session(ctx, stmts)
+	if err != nil {
+		return nil, err
+	}
+	if r.sessions == nil {
+		r.sessions = make(map[string]Database)
+	}
+	r.sessions[src] = s
+	return s, nil
+}
+
+// describe checks the query of a tag without running it, see Check. The result has a row of placeholder values,
+// or no rows if its columns are unknown.
+func (r *Renderer) describe(ctx context.Context, tag *SqlTag, args []any) (*Result, error) {
+	res := &Result{}
+	if d, ok := tag.Database.(Describer); !ok {
+		r.warnf(tag.Offset, "query not checked: the database of %s cannot check queries without running them", tag.Src)
+	} else if described, err := d.Describe(ctx, tag.Query, args); err != nil {
+		return nil, err
+	} else if described != nil {
+		row := make([]any, len(described.Columns))
+		for i, t := range described.ColumnTypes {
+			if !slices.Contains(tag.JSONColumns, t.Name) {
+				row[i] = placeholder(t)
+			}
+		}
+		res = NewResult(described.Columns, described.ColumnTypes, [][]any{row})
+	}
+	if tag.Paginate > 0 {
+		res.Page = &Page{Number: 1, Size: tag.Paginate, Total: len(res.Values), url: r.URL}
+	}
+	return res, nil
+}
+
+// placeholder returns a value of a column of type t to check templates with. Lists, structs and other nested
+// values are nil, since their fields are unknown.
+func placeholder(t ColumnType) any {
+	typ := strings.ToUpper(t.Type)
+	switch {
+	case strings.HasSuffix(typ, "]") || strings.HasPrefix(typ, "STRUCT") || strings.HasPrefix(typ, "MAP") ||
+		strings.HasPrefix(typ, "UNION") || strings.HasPrefix(typ, "JSON"):
+		return nil
+	case t.Numeric:
+		return int64(0)
+	case typ == "BOOLEAN" || typ == "BOOL":
+		return false
+	default:
+		return ""
+	}
+}
+
+// queryOptions returns the limits of the result of a tag: the tighter of the limits of the tag, the limits per
+// query and what is left of the limits of the page. It returns an error if nothing is left of the limits of
+// the page.
+func (r *Renderer) queryOptions(tag *SqlTag) (QueryOptions, error) {
+	opts := QueryOptions{MaxRows: r.MaxRows, MaxBytes: r.MaxBytes}
+	if tag.MaxRows > 0 && (opts.MaxRows == 0 || tag.MaxRows < opts.MaxRows) {
+		opts.MaxRows = tag.MaxRows
+	}
+	if r.MaxPageRows > 0 {
+		left := r.MaxPageRows - r.pageRows
+		if left <= 0 {
+			return opts, fmt.Errorf("the page reached its limit of %d rows", r.MaxPageRows)
+		}
+		if opts.MaxRows == 0 || left < opts.MaxRows {
+			opts.MaxRows = left
+		}
+	}
+	if r.MaxPageBytes > 0 {
+		left := r.MaxPageBytes - r.pageBytes
+		if left <= 0 {
+			return opts, fmt.Errorf("the page reached its limit of %d bytes", r.MaxPageBytes)
+		}
+		if opts.MaxBytes == 0 || left < opts.MaxBytes {
+			opts.MaxBytes = left
+		}
+	}
+	return opts, nil
 }
 
 func (r *Renderer) loadSql(tag *SqlTag) {
-	var err error
-	tag.Result, err = tag.Database.Query(tag.Query)
+	if tag.Database == nil {
+		return // error already recorded at start tag
+	}
+	if tag.Routes != r.RoutesOnly && !r.Check {
+		return
+	}
+
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := r.Timeout
+	if tag.Timeout > 0 {
+		timeout = tag.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if _, ok := tag.Database.(fileDatabase); ok && r.Dir != "" {
+		root := r.Root
+		if root == "" {
+			root = r.Dir
+		}
+		query, err := resolvePaths(tag.Query, r.Dir, root)
+		if err != nil {
+			r.errorf(tag.Offset, "%v", err)
+			return
+		}
+		tag.Query = query
+	}
+	query, args, err := bindParams(tag.Query, r.Params)
+	if err != nil {
+		r.errorf(tag.Offset, "binding parameters: %v", err)
+		return
+	}
+	tag.Query, tag.Args = query, args
+	if tag.Policy != nil {
+		if err := tag.Policy.CheckQuery(tag.Query, r.Root); err != nil {
+			r.errorf(tag.Offset, "query not allowed: %v", err)
+			return
+		}
+	}
+
+	opts, err := r.queryOptions(tag)
 	if err != nil {
+		r.errorf(tag.Offset, "skipping query: %v", err)
+		return
+	}
+	opts.Args = args
+
+	start := time.Now()
+	if r.Check {
+		tag.Result, err = r.describe(ctx, tag, args)
+	} else if tag.Paginate > 0 {
+		tag.Result, err = r.paginate(ctx, tag, opts)
+	} else {
+		tag.Result, err = tag.Database.Query(ctx, tag.Query, opts)
+	}
+	tag.Duration = time.Since(start)
+	if errors.Is(err, context.DeadlineExceeded) {
+		r.errorf(tag.Offset, "query timed out after %v", timeout)
+		return
+	} else if errors.Is(err, context.Canceled) {
+		r.errorf(tag.Offset, "query canceled: %v", err)
+		return
+	} else if err != nil && r.Check {
+		r.errorf(tag.Offset, "checking query: %v", err)
+		return
+	} else if err != nil {
 		r.errorf(tag.Offset, "executing query: %v", err)
 		return
 	}
+	r.pageRows += len(tag.Result.Values)
+	for _, row := range tag.Result.Values {
+		r.pageBytes += rowSize(row)
+	}
+	if tag.Result.Truncated && !(len(tag.Result.Values) == tag.MaxRows && opts.MaxRows == tag.MaxRows) {
+		r.warnf(tag.Offset, "result truncated to %d rows by the row and size limits", len(tag.Result.Values))
+	}
+
+	if err := DecodeJSONColumns(tag.Result, tag.JSONColumns); err != nil {
+		r.errorf(tag.Offset, "decoding json columns: %v", err)
+		return
+	}
+	if tag.TableName != "" {
+		r.implicitDb().Tables[tag.TableName] = tag.Result.Table()
+	}
+
+	if len(tag.GroupBy) > 0 {
+		if tag.Nest == "" {
+			tag.Nest = DefaultNest
+		}
+		tag.Result, err = GroupRows(tag.Result, tag.GroupBy, tag.Nest)
+		if err != nil {
+			r.errorf(tag.Offset, "grouping rows: %v", err)
+			return
+		}
+	}
 
 	if tag.TableName == "" {
 		return // error already recorded at start tag
 	}
 	log.Debug().Msgf("loaded table %q with %d rows (columns: %+v)", tag.TableName, len(tag.Result.Rows), tag.Result.Columns)
-	r.context[tag.TableName] = tag.Result.Rows
+	r.context[tag.TableName] = tag.Result
 	r.allSqlTags = append(r.allSqlTags, r.activeSqlTag)
 }
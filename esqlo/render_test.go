@@ -2,8 +2,10 @@ package esqlo
 
 import (
 	"bytes"
+	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,3 +56,89 @@ func TestRenderSection(t *testing.T) {
 	t.Logf("context: %+v", renderer.context)
 	assert.Len(t, renderer.Errors, 0)
 }
+
+func TestMustacheParseError(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = testDb
+
+	var out bytes.Buffer
+	src := `<sql id="p">
+SELECT * FROM persons
+</sql><p>{{p.name}}</p>
+<div>{{#p}}{{name}}</div>`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.Error(t, err)
+	require.Len(t, renderer.Errors, 1)
+	assert.Equal(t, 4, renderer.Errors[0].Line)
+	assert.Equal(t, 6, renderer.Errors[0].Col)
+	assert.Equal(t, "Section p has no closing tag", renderer.Errors[0].Msg.Error())
+	assert.Equal(t, "<p>John</p>\n<div>{{#p}}{{name}}</div>", out.String())
+}
+
+func TestStrictSuggestions(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = testDb
+
+	var out bytes.Buffer
+	src := `<meta name="esqlo" content="strict">
+<sql id="p">SELECT * FROM persons</sql>
+{{#p}}{{nmae}} {{age}}{{/p}}
+{{#pp}}{{/pp}}{{unknown}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.Error(t, err)
+	assert.Equal(t, "<meta name=\"esqlo\" content=\"strict\">\n\n 20 30\n", out.String())
+
+	var msgs []string
+	for _, err := range renderer.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		`[3:7] unknown variable "nmae" (did you mean "name"?)`,
+		`[4:1] unknown section "pp" (did you mean "p"?)`,
+		`[4:15] unknown variable "unknown"`,
+	}, msgs)
+}
+
+func TestQueryEarlierResults(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = testDb
+
+	var out bytes.Buffer
+	src := `<sql id="p">SELECT * FROM persons</sql><sql id="names">SELECT name FROM p</sql>{{#names}}{{name}} {{age}},{{/names}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, `John ,Jane ,`, out.String())
+	assert.NotContains(t, testDb.Tables, "p", "results must not leak into the configured database")
+}
+
+// slowDb is a database whose queries only finish when they are canceled.
+type slowDb struct{ MemDB }
+
+func (*slowDb) Query(ctx context.Context, query string, opts QueryOptions) (*Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestQueryTimeout(t *testing.T) {
+	RegisterDriver("slow", func() Database { return &slowDb{} })
+	defer delete(drivers, "slow")
+
+	renderer := NewRenderer()
+	renderer.Timeout = time.Hour
+	var out bytes.Buffer
+	src := "<sql src=\"slow\" id=\"a\" timeout=\"10ms\">SELECT 1</sql>\n<sql id=\"b\" timeout=\"soon\">SELECT 1</sql>"
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	assert.EqualError(t, err, "[1:39] query timed out after 10ms\n"+
+		`[2:1] timeout must be a positive duration like 2s or 500ms, got "soon"`)
+
+	renderer = NewRenderer()
+	renderer.Timeout = 10 * time.Millisecond
+	err = renderer.RenderHTML(strings.NewReader(`<sql src="slow" id="a">SELECT 1</sql>`), &out)
+	assert.EqualError(t, err, "[1:24] query timed out after 10ms")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	renderer = NewRenderer()
+	err = renderer.RenderHTMLContext(ctx, strings.NewReader(`<sql src="slow" id="a">SELECT 1</sql>`), &out)
+	assert.EqualError(t, err, "[1:24] query canceled: context canceled")
+}
@@ -0,0 +1,170 @@
+package esqlo
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Result is the result of a query. Rows holds a map[string]any of column name to value for each row, Values
+// the same values in the order of Columns.
+type Result struct {
+	Columns     []string
+	ColumnTypes []ColumnType // the type of each column, len(ColumnTypes) == len(Columns)
+	Rows        []any
+	Values      [][]any
+	Page        *Page // the page of the rows if the result is paginated, nil otherwise
+	Truncated   bool  // true if rows were left out because of the limits of QueryOptions
+}
+
+// ColumnType describes a column of a Result.
+type ColumnType struct {
+	Name     string
+	Type     string // the database type name, e.g. INTEGER or VARCHAR, or empty if unknown
+	Nullable bool   // false if the database reports that the column cannot be NULL
+	Numeric  bool   // true if the column holds numbers, e.g. to right-align them in tables
+}
+
+// NewResult returns a result with the values of each row in the order of cols. If types is nil, the types are
+// unknown and columns count as numeric if all their non-NULL values are numbers.
+func NewResult(cols []string, types []ColumnType, values [][]any) *Result {
+	if types == nil {
+		types = make([]ColumnType, len(cols))
+		for i, col := range cols {
+			types[i] = ColumnType{Name: col, Nullable: true, Numeric: numericValues(values, i)}
+		}
+	}
+
+	res := &Result{Columns: cols, ColumnTypes: types, Values: values}
+	for _, row := range values {
+		m := make(map[string]any, len(cols))
+		for i, col := range cols {
+			m[col] = row[i]
+		}
+		res.Rows = append(res.Rows, m)
+	}
+	return res
+}
+
+// DecodeJSONColumns decodes the JSON text in the columns cols of every row, so lists and objects can be
+// iterated in templates like LIST and STRUCT columns:
+//
+//	<sql id="reviews" json-columns="meta">SELECT id, meta FROM reviews</sql>
+//	{{#reviews}}{{#meta.tags}}{{.}} {{/meta.tags}}{{/reviews}}
+//
+// Columns of the JSON and JSONB database types are decoded when they are read and need not be listed.
+func DecodeJSONColumns(res *Result, cols []string) error {
+	for _, col := range cols {
+		i := slices.Index(res.Columns, col)
+		if i < 0 {
+			return fmt.Errorf("json column %q not found in result columns %v", col, res.Columns)
+		}
+		for r, row := range res.Values {
+			s, ok := row[i].(string)
+			if !ok || strings.TrimSpace(s) == "" {
+				continue // NULL, empty or already decoded
+			}
+			v, err := decodeJSON(s)
+			if err != nil {
+				return fmt.Errorf("column %q of row %d: %w", col, r+1, err)
+			}
+			row[i] = v
+			res.Rows[r].(map[string]any)[col] = v
+		}
+		res.ColumnTypes[i].Numeric = false
+	}
+	return nil
+}
+
+// columnTypes converts the column types reported by database/sql.
+func columnTypes(types []*sql.ColumnType) []ColumnType {
+	var cts []ColumnType
+	for _, t := range types {
+		nullable, ok := t.Nullable()
+		cts = append(cts, ColumnType{
+			Name:     t.Name(),
+			Type:     t.DatabaseTypeName(),
+			Nullable: nullable || !ok,
+			Numeric:  isNumericType(t.DatabaseTypeName()),
+		})
+	}
+	return cts
+}
+
+// isNumericType reports whether a database type name, e.g. BIGINT or DECIMAL(18,3), is a number type.
+func isNumericType(name string) bool {
+	name, _, _ = strings.Cut(strings.ToUpper(name), "(")
+	switch strings.TrimSpace(name) {
+	case "TINYINT", "SMALLINT", "INT", "INTEGER", "BIGINT", "HUGEINT", "UTINYINT", "USMALLINT", "UINTEGER",
+		"UBIGINT", "UHUGEINT", "INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL", "REAL", "FLOAT", "FLOAT4", "FLOAT8",
+		"DOUBLE", "DOUBLE PRECISION", "DECIMAL", "NUMERIC":
+		return true
+	}
+	return false
+}
+
+// numericValues reports whether the non-NULL values of column col are all numbers, and there is at least one.
+func numericValues(values [][]any, col int) bool {
+	numeric := false
+	for _, row := range values {
+		if row[col] == nil {
+			continue
+		}
+		switch reflect.ValueOf(row[col]).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			numeric = true
+		default:
+			return false
+		}
+	}
+	return numeric
+}
+
+// List returns the rows of the result, so templates can iterate over a result like over a list of rows.
+func (r *Result) List() []any {
+	return r.Rows
+}
+
+// Get resolves the metadata of a result in templates:
+//
+//	{{reviews.$columns}} the columns with their name, type, nullable and numeric
+//	{{reviews.$rows}}    the rows, each a list of cells with the value and the name, type and numeric of its column
+//	{{reviews.$truncated}} true if rows were left out because of the row or size limits
+//
+// and the page of paginated results, see Page.
+//
+// so a generic template can render any result as a table:
+//
+//	<tr>{{#reviews.$columns}}<th>{{name}}</th>{{/reviews.$columns}}</tr>
+//	{{#reviews.$rows}}<tr>{{#.}}<td {{#numeric}}align="right"{{/numeric}}>{{value}}</td>{{/.}}</tr>{{/reviews.$rows}}
+func (r *Result) Get(name string) (any, bool) {
+	switch name {
+	case "$columns":
+		cols := make([]any, len(r.ColumnTypes))
+		for i, t := range r.ColumnTypes {
+			cols[i] = map[string]any{"name": r.Columns[i], "type": t.Type, "nullable": t.Nullable, "numeric": t.Numeric}
+		}
+		return cols, true
+	case "$rows":
+		rows := make([]any, len(r.Values))
+		for i, values := range r.Values {
+			cells := make([]any, len(values))
+			for j, v := range values {
+				t := r.ColumnTypes[j]
+				cells[j] = map[string]any{"value": v, "name": r.Columns[j], "type": t.Type, "numeric": t.Numeric}
+			}
+			rows[i] = cells
+		}
+		return rows, true
+	case "$truncated":
+		return r.Truncated, true
+	}
+	if r.Page != nil {
+		return r.Page.get(name)
+	}
+	return nil, false
+}
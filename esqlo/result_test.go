@@ -0,0 +1,75 @@
+package esqlo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderColumns(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = testDb
+
+	var out bytes.Buffer
+	src := `<sql id="p">SELECT name, age FROM persons WHERE age > 25</sql>` +
+		`<tr>{{#p.$columns}}<th>{{name}}</th>{{/p.$columns}}</tr>` +
+		`{{#p.$rows}}<tr>{{#.}}<td{{#numeric}} align="right"{{/numeric}}>{{value}}</td>{{/.}}</tr>{{/p.$rows}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, `<tr><th>name</th><th>age</th></tr><tr><td>Jane</td><td align="right">30</td></tr>`, out.String())
+}
+
+func TestNewResult(t *testing.T) {
+	res := NewResult([]string{"name", "age", "score"}, nil, [][]any{{"John", 20, nil}, {"Jane", nil, nil}})
+	assert.Equal(t, []any{
+		map[string]any{"name": "John", "age": 20, "score": nil},
+		map[string]any{"name": "Jane", "age": nil, "score": nil},
+	}, res.Rows)
+	assert.Equal(t, []ColumnType{
+		{Name: "name", Nullable: true},
+		{Name: "age", Nullable: true, Numeric: true},
+		{Name: "score", Nullable: true},
+	}, res.ColumnTypes)
+	assert.Equal(t, res.Rows, res.List())
+
+	_, ok := res.Get("$nope")
+	assert.False(t, ok)
+}
+
+func TestRenderJSONColumns(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.Databases[ImplicitDb] = &MemDB{Tables: map[string]*MemTable{
+		"reviews": {
+			Columns: []string{"id", "meta"},
+			Rows: [][]any{
+				{1, `{"tags": ["fast", "cheap"], "visits": 2}`},
+				{2, nil},
+				{3, `{"tags": []}`},
+			},
+		},
+	}}
+
+	var out bytes.Buffer
+	src := `<sql id="r" json-columns="meta">SELECT * FROM reviews</sql>` +
+		`{{#r}}{{id}}:{{#meta.tags}}{{.}}{{^@last}},{{/@last}}{{/meta.tags}}{{#meta}}({{visits}}){{/meta}} {{/r}}`
+	err := renderer.RenderHTML(strings.NewReader(src), &out)
+	require.NoError(t, err)
+	assert.Equal(t, `1:fast,cheap(2) 2: 3:() `, out.String())
+	assert.Equal(t, int64(2), renderer.context["r"].(*Result).Values[0][1].(map[string]any)["visits"])
+
+	renderer = NewRenderer()
+	renderer.Databases[ImplicitDb] = testDb
+	err = renderer.RenderHTML(strings.NewReader(`<sql id="p" json-columns="name">SELECT * FROM persons</sql>`), &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `decoding json columns: column "name" of row 1: invalid JSON: invalid character 'J'`)
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	assert.Equal(t, map[string]any{"a": []any{int64(1), 1.5}}, normalizeColumn("JSON", `{"a": [1, 1.5]}`, nil))
+	assert.Equal(t, []any{"x"}, normalizeColumn("jsonb", []byte(`["x"]`), nil))
+	assert.Equal(t, "{", normalizeColumn("JSON", "{", nil), "invalid JSON is kept as text")
+	assert.Equal(t, `["x"]`, normalizeColumn("VARCHAR", `["x"]`, nil))
+}
@@ -0,0 +1,97 @@
+package esqlo
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Dynamic routes are templates with parameters in brackets in their path, e.g. restaurants/[name].html. The
+// template serves every path that matches, like /restaurants/McDonalds.html, with the parameter name set to
+// McDonalds. Queries refer to parameters as :name and templates as {{params.name}}:
+//
+//	<sql src="duckdb" id="reviews">SELECT * FROM 'reviews.csv' WHERE restaurant = :name</sql>
+//
+// A sql tag with the routes attribute lists the values of the parameters, one row per page with a column for
+// each parameter, so that Handler.Build can render every page. It only runs when building.
+//
+//	<sql src="duckdb" id="restaurants" routes>SELECT DISTINCT restaurant AS name FROM 'reviews.csv'</sql>
+
+// isDynamic reports whether a path of a template has parameters.
+func isDynamic(p string) bool {
+	return strings.Contains(p, "[") && strings.Contains(p, "]")
+}
+
+// segmentParam returns the name of the parameter of a segment of a path like [name] or [name].html, and the
+// suffix after it.
+func segmentParam(segment string) (name, suffix string, ok bool) {
+	if !strings.HasPrefix(segment, "[") {
+		return "", "", false
+	}
+	end := strings.Index(segment, "]")
+	if end < 2 {
+		return "", "", false
+	}
+	return segment[1:end], segment[end+1:], true
+}
+
+// matchRoute finds the template of root that serves the URL path p, preferring files that exist over dynamic
+// routes in every directory. It returns the path of the template relative to root and the values of its
+// parameters.
+func matchRoute(root, p string) (string, map[string]string, bool) {
+	segments := strings.Split(strings.TrimPrefix(path.Clean("/"+p), "/"), "/")
+	params := make(map[string]string)
+	dir := ""
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if fi, err := os.Stat(filepath.Join(root, dir, segment)); err == nil && fi.IsDir() != last {
+			dir = path.Join(dir, segment)
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(dir)))
+		if err != nil {
+			return "", nil, false
+		}
+		found := false
+		for _, e := range entries {
+			name, suffix, ok := segmentParam(e.Name())
+			if !ok || e.IsDir() == last || !strings.HasSuffix(segment, suffix) || len(segment) == len(suffix) {
+				continue
+			}
+			params[name] = strings.TrimSuffix(segment, suffix)
+			dir = path.Join(dir, e.Name())
+			found = true
+			break
+		}
+		if !found {
+			return "", nil, false
+		}
+	}
+	return dir, params, true
+}
+
+// expandRoute replaces the parameters of the path of a template with their values in a row of the routes of
+// the template. Values must be valid file names.
+func expandRoute(tmpl string, row map[string]any) (string, map[string]string, error) {
+	segments := strings.Split(tmpl, "/")
+	params := make(map[string]string)
+	for i, segment := range segments {
+		name, suffix, ok := segmentParam(segment)
+		if !ok {
+			continue
+		}
+		v, ok := row[name]
+		if !ok {
+			return "", nil, fmt.Errorf("the routes have no column %q", name)
+		}
+		value := fmt.Sprint(Normalize(v))
+		if v == nil || value == "" || value == "." || value == ".." || strings.ContainsAny(value, `/\`) {
+			return "", nil, fmt.Errorf("invalid value %q of %s: it must be a valid file name", value, name)
+		}
+		params[name] = value
+		segments[i] = value + suffix
+	}
+	return strings.Join(segments, "/"), params, nil
+}
@@ -0,0 +1,54 @@
+package esqlo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchRoute(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{"index.html", "restaurants/[name].html", "restaurants/top.html", "cities/[city]/[name].html"} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, nil, 0o644))
+	}
+
+	tests := []struct {
+		path   string
+		tmpl   string
+		params map[string]string
+	}{
+		{"/index.html", "index.html", map[string]string{}},
+		{"/restaurants/top.html", "restaurants/top.html", map[string]string{}},
+		{"/restaurants/McDonalds.html", "restaurants/[name].html", map[string]string{"name": "McDonalds"}},
+		{"/cities/Paris/Chez Nous.html", "cities/[city]/[name].html", map[string]string{"city": "Paris", "name": "Chez Nous"}},
+		{"/restaurants/.html", "", nil},
+		{"/menus/x.html", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			tmpl, params, ok := matchRoute(root, tt.path)
+			assert.Equal(t, tt.tmpl != "", ok)
+			assert.Equal(t, tt.tmpl, tmpl)
+			assert.Equal(t, tt.params, params)
+		})
+	}
+}
+
+func TestExpandRoute(t *testing.T) {
+	page, params, err := expandRoute("cities/[city]/[name].html", map[string]any{"city": "Paris", "name": "Chez Nous", "n": 3})
+	require.NoError(t, err)
+	assert.Equal(t, "cities/Paris/Chez Nous.html", page)
+	assert.Equal(t, map[string]string{"city": "Paris", "name": "Chez Nous"}, params)
+
+	_, _, err = expandRoute("[id].html", map[string]any{"name": "x"})
+	assert.EqualError(t, err, `the routes have no column "id"`)
+	_, _, err = expandRoute("[id].html", map[string]any{"id": "../secret"})
+	assert.EqualError(t, err, `invalid value "../secret" of id: it must be a valid file name`)
+	_, _, err = expandRoute("[id].html", map[string]any{"id": nil})
+	assert.Error(t, err)
+}
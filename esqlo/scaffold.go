@@ -0,0 +1,57 @@
+package esqlo
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// scaffold is the starter project of Scaffold.
+//
+//go:embed all:scaffold
+var scaffold embed.FS
+
+// Scaffold writes a starter project into dir: a site with a paginated table of the products of a CSV file and a
+// page of each product, its layout and partials, a policy of its DuckDB source and a Makefile to serve, check,
+// build and test it. It fails without writing anything if any of the files already exist, or if DuckDB is not
+// available to query the data of the project.
+func Scaffold(dir string) error {
+	if _, ok := drivers["duckdb"]; !ok {
+		return errors.New("the project queries its data with DuckDB, which requires a build with CGO enabled")
+	}
+	root, err := fs.Sub(scaffold, "scaffold")
+	if err != nil {
+		return err
+	}
+	var files []string
+	err = fs.WalkDir(root, ".", func(name string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		data, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
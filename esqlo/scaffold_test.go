@@ -0,0 +1,32 @@
+package esqlo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaffold(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok := drivers["duckdb"]; !ok {
+		assert.EqualError(t, Scaffold(dir), "the project queries its data with DuckDB, which requires a build with CGO enabled")
+		assert.NoFileExists(t, filepath.Join(dir, "Makefile"))
+		return
+	}
+	require.NoError(t, Scaffold(dir))
+	for _, name := range []string{"Makefile", ".gitignore", "policy.yml", "data/products.csv", "site/index.html",
+		"site/products/[slug].html", "site/partials/header.mustache"} {
+		assert.FileExists(t, filepath.Join(dir, filepath.FromSlash(name)))
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("mine"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "Makefile")))
+	assert.EqualError(t, Scaffold(dir), filepath.Join(dir, ".gitignore")+" already exists")
+	assert.NoFileExists(t, filepath.Join(dir, "Makefile"), "nothing is written if a file exists")
+	b, err := os.ReadFile(filepath.Join(dir, "site", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "mine", string(b))
+}
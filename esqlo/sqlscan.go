@@ -0,0 +1,203 @@
+package esqlo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlTokenKind is the kind of a token of a SQL query.
+type sqlTokenKind int
+
+const (
+	sqlWord   sqlTokenKind = iota // keyword or unquoted identifier
+	sqlIdent                      // quoted identifier, e.g. "name" or `name`
+	sqlString                     // string literal, e.g. 'text', E'text' or $$text$$
+	sqlNumber                     // numeric literal
+	sqlPunct                      // operators and punctuation, e.g. ( ) , ; =
+)
+
+// sqlToken is a token of a SQL query. Offset and End are the byte offsets of the token in the query.
+type sqlToken struct {
+	Kind        sqlTokenKind
+	Text        string // the text of the token as written, e.g. with quotes
+	Value       string // the value of string literals and quoted identifiers without quotes and escapes
+	Offset, End int
+}
+
+// is reports whether the token is the keyword kw, ignoring case.
+func (t sqlToken) is(kw string) bool {
+	return t.Kind == sqlWord && strings.EqualFold(t.Text, kw)
+}
+
+// scanSQL splits a query into tokens, skipping whitespace and comments. It understands the quoting of most SQL
+// dialects: 'strings' with ” escapes, E'strings' with backslash escapes, $tag$dollar quoted strings$tag$,
+// "identifiers" and `identifiers`.
+func scanSQL(query string) ([]sqlToken, error) {
+	var toks []sqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated comment at offset %d", start)
+			}
+			i += j + 4
+		case (c == 'e' || c == 'E') && i+1 < len(query) && query[i+1] == '\'':
+			value, end, err := scanQuoted(query, i+1, '\'', true)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, sqlToken{Kind: sqlString, Text: query[start:end], Value: value, Offset: start, End: end})
+			i = end
+		case c == '\'' || c == '"' || c == '`':
+			value, end, err := scanQuoted(query, i, c, false)
+			if err != nil {
+				return nil, err
+			}
+			kind := sqlIdent
+			if c == '\'' {
+				kind = sqlString
+			}
+			toks = append(toks, sqlToken{Kind: kind, Text: query[start:end], Value: value, Offset: start, End: end})
+			i = end
+		case c == '$' && dollarTag(query[i:]) != "":
+			tag := dollarTag(query[i:])
+			j := strings.Index(query[i+len(tag):], tag)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			end := i + len(tag) + j + len(tag)
+			toks = append(toks, sqlToken{Kind: sqlString, Text: query[start:end], Value: query[i+len(tag) : end-len(tag)], Offset: start, End: end})
+			i = end
+		case isWordStart(c):
+			for i < len(query) && (isWordStart(query[i]) || isDigit(query[i]) || query[i] == '$') {
+				i++
+			}
+			toks = append(toks, sqlToken{Kind: sqlWord, Text: query[start:i], Offset: start, End: i})
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.' || query[i] == '_' || query[i] == 'e' || query[i] == 'E' ||
+				(query[i] == '+' || query[i] == '-') && (query[i-1] == 'e' || query[i-1] == 'E')) {
+				i++
+			}
+			toks = append(toks, sqlToken{Kind: sqlNumber, Text: query[start:i], Offset: start, End: i})
+		default:
+			i++
+			toks = append(toks, sqlToken{Kind: sqlPunct, Text: query[start:i], Offset: start, End: i})
+		}
+	}
+	return toks, nil
+}
+
+// scanQuoted scans a quoted string or identifier starting with the quote at query[i] and returns its value and
+// the offset after the closing quote. Doubled quotes are escapes for the quote, and so are backslashes if
+// backslash is true.
+func scanQuoted(query string, i int, quote byte, backslash bool) (string, int, error) {
+	var sb strings.Builder
+	for j := i + 1; j < len(query); j++ {
+		switch {
+		case backslash && query[j] == '\\' && j+1 < len(query):
+			j++
+			sb.WriteByte(query[j])
+		case query[j] == quote && j+1 < len(query) && query[j+1] == quote:
+			j++
+			sb.WriteByte(quote)
+		case query[j] == quote:
+			return sb.String(), j + 1, nil
+		default:
+			sb.WriteByte(query[j])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quote at offset %d", i)
+}
+
+// dollarTag returns the opening tag of a dollar quoted string at the start of s, e.g. $$ or $body$, or "" if s
+// does not start with one.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		if s[j] == '$' {
+			return s[:j+1]
+		}
+		if !isWordStart(s[j]) && !(j > 1 && isDigit(s[j])) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWordStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// splitStatements splits the tokens of a query into statements separated by semicolons. Empty statements are
+// left out.
+func splitStatements(toks []sqlToken) [][]sqlToken {
+	var stmts [][]sqlToken
+	start := 0
+	for i, tok := range toks {
+		if tok.Kind == sqlPunct && tok.Text == ";" {
+			if i > start {
+				stmts = append(stmts, toks[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(toks) {
+		stmts = append(stmts, toks[start:])
+	}
+	return stmts
+}
+
+// queryKinds maps the keywords that start a query, also after WITH, to the kind of the statement.
+var queryKinds = map[string]string{
+	"SELECT": "SELECT", "VALUES": "SELECT", "FROM": "SELECT", "TABLE": "SELECT",
+	"INSERT": "INSERT", "UPDATE": "UPDATE", "DELETE": "DELETE", "MERGE": "MERGE",
+}
+
+// statementKind returns the kind of a statement as an upper case keyword, e.g. SELECT or INSERT. Queries such as
+// VALUES (1), FROM tbl, TABLE tbl and (SELECT 1) are SELECTs, and WITH queries are of the kind of the statement
+// after the common table expressions.
+func statementKind(stmt []sqlToken) string {
+	depth := 0
+	with := false
+	for i, tok := range stmt {
+		switch {
+		case tok.Kind == sqlPunct && tok.Text == "(":
+			if i == 0 {
+				return "SELECT"
+			}
+			depth++
+		case tok.Kind == sqlPunct && tok.Text == ")":
+			depth--
+		case tok.Kind == sqlWord && depth == 0:
+			kw := strings.ToUpper(tok.Text)
+			if i == 0 && kw == "WITH" {
+				with = true
+				continue
+			}
+			if kind, ok := queryKinds[kw]; ok {
+				return kind
+			}
+			if !with {
+				return kw
+			}
+		}
+	}
+	if with {
+		return "WITH"
+	}
+	return ""
+}
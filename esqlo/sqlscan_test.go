@@ -0,0 +1,51 @@
+package esqlo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanSQL(t *testing.T) {
+	toks, err := scanSQL(`SELECT "a""b", 'it''s', E'\'x', $q$don't$q$, 1.5e-3 -- comment ;
+	/* ; */ FROM t;`)
+	require.NoError(t, err)
+	var texts, values []string
+	for _, tok := range toks {
+		texts = append(texts, tok.Text)
+		values = append(values, tok.Value)
+	}
+	assert.Equal(t, []string{"SELECT", `"a""b"`, ",", `'it''s'`, ",", `E'\'x'`, ",", "$q$don't$q$", ",", "1.5e-3", "FROM", "t", ";"}, texts)
+	assert.Equal(t, []string{"", `a"b`, "", "it's", "", "'x", "", "don't", "", "", "", "", ""}, values)
+	assert.Equal(t, 7, toks[1].Offset)
+	assert.Equal(t, 13, toks[1].End)
+
+	_, err = scanSQL(`SELECT 'abc`)
+	assert.EqualError(t, err, "unterminated quote at offset 7")
+	_, err = scanSQL(`SELECT 1 /* abc`)
+	assert.EqualError(t, err, "unterminated comment at offset 9")
+}
+
+func TestStatementKind(t *testing.T) {
+	tests := []struct {
+		query string
+		kinds []string
+	}{
+		{"select 1", []string{"SELECT"}},
+		{"VALUES (1); FROM t; TABLE t; (SELECT 1) UNION (SELECT 2)", []string{"SELECT", "SELECT", "SELECT", "SELECT"}},
+		{"WITH a AS (DELETE FROM t RETURNING *), b AS MATERIALIZED (SELECT 1) SELECT * FROM a", []string{"SELECT"}},
+		{"WITH RECURSIVE a AS (SELECT 1) INSERT INTO t SELECT * FROM a", []string{"INSERT"}},
+		{"copy t TO 'out.csv';; install httpfs", []string{"COPY", "INSTALL"}},
+		{"-- nothing", nil},
+	}
+	for _, test := range tests {
+		toks, err := scanSQL(test.query)
+		require.NoError(t, err)
+		var kinds []string
+		for _, stmt := range splitStatements(toks) {
+			kinds = append(kinds, statementKind(stmt))
+		}
+		assert.Equal(t, test.kinds, kinds, test.query)
+	}
+}
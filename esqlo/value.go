@@ -0,0 +1,233 @@
+package esqlo
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Layouts used to format Time values by default.
+const (
+	DateLayout      = "2006-01-02"
+	TimeLayout      = "15:04:05.999999"
+	TimestampLayout = "2006-01-02 15:04:05.999999"
+)
+
+// Decimal is an exact decimal number with the value Value * 10^-Scale, e.g. {12345, 2} is 123.45.
+type Decimal struct {
+	Value *big.Int
+	Scale int
+}
+
+// String formats the decimal with exactly Scale digits after the decimal point.
+func (d Decimal) String() string {
+	if d.Value == nil {
+		return "0"
+	}
+	digits := new(big.Int).Abs(d.Value).String()
+	sign := ""
+	if d.Value.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale <= 0 {
+		return sign + digits + strings.Repeat("0", -d.Scale)
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+}
+
+// Float64 returns the nearest float64 to the decimal.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Time is a date, time of day or timestamp that is formatted with Layout, e.g. DateLayout for DATE columns.
+type Time struct {
+	time.Time
+	Layout string
+}
+
+func (t Time) String() string {
+	layout := t.Layout
+	if layout == "" {
+		layout = TimestampLayout
+	}
+	if t.Location() != time.UTC && layout != DateLayout {
+		layout += " Z07:00"
+	}
+	return t.Format(layout)
+}
+
+// converter converts backend-specific values, e.g. the decimals of a driver, into normalized values. typ is the
+// database type name of the column for values of a column and empty for the elements of lists and maps. It
+// returns false for values it does not know.
+type converter func(typ string, v any) (any, bool)
+
+// Normalize converts a value read from a database into one of the types that templates and MemDB handle
+// consistently regardless of the backend:
+//
+//	nil                      NULL
+//	string                   text, and []byte if it is valid UTF-8
+//	int64                    all integer types, and *big.Int that fit
+//	float64                  float32 and float64
+//	Decimal                  exact numbers, and *big.Int that do not fit int64
+//	Time                     time.Time, formatted with TimestampLayout
+//	bool                     booleans
+//	[]any                    lists and arrays, with normalized elements
+//	map[string]any           maps and structs, with normalized values
+//
+// Any other value becomes a string using its String method or fmt.Sprint. Binary data that is not valid UTF-8
+// is formatted as hex with a \x prefix.
+func Normalize(v any) any {
+	return normalize("", v, nil)
+}
+
+func normalize(typ string, v any, convert converter) any {
+	if convert != nil {
+		if nv, ok := convert(typ, v); ok {
+			return nv
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string, int64, float64, bool, Decimal, Time:
+		return v
+	case time.Time:
+		return Time{Time: v, Layout: TimestampLayout}
+	case *big.Int:
+		if v == nil {
+			return nil
+		}
+		if v.IsInt64() {
+			return v.Int64()
+		}
+		return Decimal{Value: new(big.Int).Set(v)}
+	case float32:
+		// format with float32 precision so 0.1 does not become 0.10000000149011612
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		return f
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []byte:
+		return bytesString(v)
+	case fmt.Stringer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil
+		}
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalize(typ, rv.Elem().Interface(), convert)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+		return Decimal{Value: new(big.Int).SetUint64(rv.Uint())}
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.Slice {
+			return bytesString(rv.Bytes())
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = normalize("", rv.Index(i).Interface(), convert)
+		}
+		return list
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		m := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(normalize("", iter.Key().Interface(), convert))] = normalize("", iter.Value().Interface(), convert)
+		}
+		return m
+	case reflect.Struct:
+		m := make(map[string]any, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			if f := rv.Type().Field(i); f.IsExported() {
+				m[f.Name] = normalize("", rv.Field(i).Interface(), convert)
+			}
+		}
+		return m
+	}
+	return fmt.Sprint(v)
+}
+
+// bytesString returns b as a string if it is valid UTF-8 and as hex with a \x prefix otherwise.
+func bytesString(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return `\x` + hex.EncodeToString(b)
+}
+
+// normalizeColumn normalizes a value of a column of the database type typ. Times in DATE and TIME columns are
+// formatted as dates and times of day, and JSON in JSON and JSONB columns is decoded.
+func normalizeColumn(typ string, v any, convert converter) any {
+	v = normalize(typ, v, convert)
+	switch v := v.(type) {
+	case Time:
+		switch strings.ToUpper(typ) {
+		case "DATE":
+			v.Layout = DateLayout
+		case "TIME":
+			v.Layout = TimeLayout
+		}
+		return v
+	case string:
+		if typ := strings.ToUpper(typ); typ == "JSON" || typ == "JSONB" {
+			if decoded, err := decodeJSON(v); err == nil {
+				return decoded
+			}
+		}
+	}
+	return v
+}
+
+// decodeJSON decodes a JSON value with numbers as int64 or float64, see Normalize.
+func decodeJSON(s string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the value")
+	}
+	return jsonValue(v), nil
+}
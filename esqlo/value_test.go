@@ -0,0 +1,82 @@
+package esqlo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+func TestNormalize(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 500_000_000, time.UTC)
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	var nilInt *int
+	one := 1
+
+	tests := []struct {
+		name     string
+		value    any
+		expected any
+		str      string // default formatting
+	}{
+		{"null", nil, nil, "<nil>"},
+		{"null pointer", nilInt, nil, "<nil>"},
+		{"pointer", &one, int64(1), "1"},
+		{"string", "hello", "hello", "hello"},
+		{"bytes", []byte("hello"), "hello", "hello"},
+		{"binary", []byte{0xff, 0x00}, `\xff00`, `\xff00`},
+		{"int", 42, int64(42), "42"},
+		{"int8", int8(-8), int64(-8), "-8"},
+		{"int32", int32(32), int64(32), "32"},
+		{"uint64", uint64(64), int64(64), "64"},
+		{"uint64 overflow", uint64(math.MaxUint64), Decimal{Value: new(big.Int).SetUint64(math.MaxUint64)}, "18446744073709551615"},
+		{"big int", big.NewInt(7), int64(7), "7"},
+		{"huge int", huge, Decimal{Value: huge}, "123456789012345678901234567890"},
+		{"float32", float32(0.1), 0.1, "0.1"},
+		{"float64", 2.5, 2.5, "2.5"},
+		{"json number", json.Number("3"), int64(3), "3"},
+		{"decimal", Decimal{Value: big.NewInt(-1205), Scale: 3}, Decimal{Value: big.NewInt(-1205), Scale: 3}, "-1.205"},
+		{"timestamp", ts, Time{Time: ts, Layout: TimestampLayout}, "2024-01-02 03:04:05.5"},
+		{"bool", true, true, "true"},
+		{"list", []int32{1, 2}, []any{int64(1), int64(2)}, "[1 2]"},
+		{"nested list", []any{"a", []any{int8(1)}}, []any{"a", []any{int64(1)}}, "[a [1]]"},
+		{"map", map[any]any{1: float32(1.5), "b": nil}, map[string]any{"1": 1.5, "b": nil}, "map[1:1.5 b:<nil>]"},
+		{"struct", struct {
+			A int16
+			b int
+		}{A: 1, b: 2}, map[string]any{"A": int64(1)}, "map[A:1]"},
+		{"stringer", stringer{}, "stringer", "stringer"},
+		{"other", complex(1, 2), "(1+2i)", "(1+2i)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := Normalize(test.value)
+			assert.Equal(t, test.expected, v)
+			assert.Equal(t, test.str, fmt.Sprint(v))
+		})
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	assert.Equal(t, "0.05", Decimal{Value: big.NewInt(5), Scale: 2}.String())
+	assert.Equal(t, "-0.05", Decimal{Value: big.NewInt(-5), Scale: 2}.String())
+	assert.Equal(t, "1200", Decimal{Value: big.NewInt(12), Scale: -2}.String())
+	assert.Equal(t, "0", Decimal{}.String())
+	assert.Equal(t, 12.5, Decimal{Value: big.NewInt(1250), Scale: 2}.Float64())
+}
+
+func TestTimeLayouts(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, "2024-01-02", normalizeColumn("DATE", ts, nil).(Time).String())
+	assert.Equal(t, "03:04:05", normalizeColumn("TIME", ts, nil).(Time).String())
+	assert.Equal(t, "2024-01-02 03:04:05", normalizeColumn("TIMESTAMP", ts, nil).(Time).String())
+	assert.Equal(t, "2024-01-02 03:04:05 +02:00", Time{Time: ts.In(time.FixedZone("", 2*60*60)).Add(-2 * time.Hour)}.String())
+}
@@ -2,7 +2,11 @@ module github.com/masp/esqlo
 
 go 1.21.3
 
-require golang.org/x/net v0.19.0
+require (
+	go.lsp.dev/uri v0.3.0
+	golang.org/x/crypto v0.18.0
+	golang.org/x/net v0.19.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -15,7 +19,6 @@ require (
 	github.com/rs/zerolog v1.31.0 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2 // indirect
-	go.lsp.dev/uri v0.3.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/masp/esqlo/esqlo"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// initProject writes a starter project into a directory, checks it and renders its golden files.
+func initProject(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s init [directory]\n", os.Args[0])
+	}
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	if err := esqlo.Scaffold(dir); err != nil {
+		fail("creating a project in %s: %v", dir, err)
+	}
+
+	var opts options
+	opts.register(flag.NewFlagSet("", flag.ExitOnError))
+	opts.dir, opts.dataDir, opts.policy = filepath.Join(dir, "site"), filepath.Join(dir, "data"), filepath.Join(dir, "policy.yml")
+	h := opts.handler()
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel) // warnings are printed as diagnostics
+	diags, err := h.Check()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if err != nil {
+		fail("checking %s: %v", opts.dir, err)
+	}
+	var errs int
+	for _, d := range diags {
+		fmt.Println(d)
+		if !d.Warning {
+			errs++
+		}
+	}
+	if errs > 0 {
+		fail("the project in %s has %d errors", dir, errs)
+	}
+	golden := filepath.Join(dir, "testdata", "golden")
+	if err := h.Build(golden); err != nil {
+		log.Warn().Msgf("the golden files of the tests were not written, run make golden to write them: %v", err)
+	}
+	log.Info().Msgf("created a project in %s, run make serve in it to serve its site", dir)
+}
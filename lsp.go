@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/masp/esqlo/esqlo/lsp"
+)
+
+// serveLSP runs a language server of the templates of a directory on stdin and stdout.
+func serveLSP(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	var opts options
+	opts.register(fs)
+	fs.Parse(args)
+	if opts.dir == "" {
+		opts.dir = "." // editors start the server in the root of the workspace
+	}
+
+	s := &lsp.Server{Handler: opts.handler()}
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		fail("language server: %v", err)
+	}
+}
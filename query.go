@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/masp/esqlo/esqlo"
+)
+
+const queryUsage = `usage: %s query [flags] <template> [name=value ...]
+
+Runs the sql tags of a template and prints the query, timing and result of each. The parameters set the
+parameters of dynamic routes, e.g. name=McDonalds for restaurants/[name].html, and the query of the URL of the
+page, e.g. page=2.
+
+`
+
+// query runs the sql tags of a template and prints their results.
+func query(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), queryUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	var opts options
+	opts.register(fs)
+	format := fs.String("format", "table", "output format: table, json or csv")
+	only := fs.String("tag", "", "only print the sql tag with this id")
+	userID := fs.String("user", "", "render the page for the user with this id (default: anonymous)")
+	tenant := fs.String("tenant", "", "tenant of the user")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "table" && *format != "json" && *format != "csv" {
+		fail("unknown format %q, expected table, json or csv", *format)
+	}
+
+	file := fs.Arg(0)
+	if opts.dir == "" {
+		opts.dir = filepath.Dir(file)
+	}
+	tmpl, err := filepath.Rel(opts.dir, file)
+	if err != nil || strings.HasPrefix(tmpl, "..") {
+		fail("%s is not inside of %s", file, opts.dir)
+	}
+	params := make(map[string]string)
+	q := make(url.Values)
+	for _, arg := range fs.Args()[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			fail("invalid parameter %q, expected name=value", arg)
+		}
+		params[name] = value
+		q.Set(name, value)
+	}
+	var user *esqlo.User
+	if *userID != "" {
+		user = &esqlo.User{ID: *userID, Name: *userID, Tenant: *tenant}
+	}
+
+	h := opts.handler()
+	f, err := os.Open(file)
+	if err != nil {
+		fail("%v", err)
+	}
+	defer f.Close()
+	tmpl = "/" + filepath.ToSlash(tmpl)
+	render := h.Renderer(&url.URL{Path: tmpl, RawQuery: q.Encode()}, tmpl, user, params)
+	renderErr := render.RenderHTMLContext(context.Background(), f, io.Discard)
+
+	var tags []*esqlo.SqlTag
+	for _, tag := range render.Tags() {
+		if *only == "" || tag.TableName == *only {
+			tags = append(tags, tag)
+		}
+	}
+	switch *format {
+	case "table":
+		err = printTables(os.Stdout, tags)
+	case "json":
+		err = printJSON(os.Stdout, tags)
+	case "csv":
+		err = printCSV(os.Stdout, tags)
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+	if renderErr != nil {
+		fail("%s:\n%v", file, renderErr)
+	}
+}
+
+// printTables prints the query, timing and rows of each tag as aligned columns.
+func printTables(w io.Writer, tags []*esqlo.SqlTag) error {
+	for i, tag := range tags {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "-- %s: %s\n", tag.TableName, summary(tag))
+		fmt.Fprintln(w, strings.TrimSpace(tag.Query))
+		if len(tag.Args) > 0 {
+			fmt.Fprintf(w, "-- arguments: %v\n", formatArgs(tag.Args))
+		}
+		fmt.Fprintln(w)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		res := tag.Result
+		fmt.Fprintln(tw, strings.Join(res.Columns, "\t"))
+		dashes := make([]string, len(res.Columns))
+		for i, col := range res.Columns {
+			dashes[i] = strings.Repeat("-", len(col))
+		}
+		fmt.Fprintln(tw, strings.Join(dashes, "\t"))
+		for _, row := range res.Values {
+			cells := make([]string, len(row))
+			for i, v := range row {
+				cells[i] = formatValue(v)
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary describes where the result of a tag came from and how long it took, e.g. "duckdb, 3 rows in 2ms".
+func summary(tag *esqlo.SqlTag) string {
+	s := fmt.Sprintf("%s, %d rows in %v", tag.Src, len(tag.Result.Values), tag.Duration.Round(time.Microsecond))
+	if tag.Result.Truncated {
+		s += ", truncated"
+	}
+	if p := tag.Result.Page; p != nil {
+		s += fmt.Sprintf(", page %d of %d rows each", p.Number, p.Size)
+	}
+	return s
+}
+
+func formatArgs(args []any) string {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = fmt.Sprintf("$%d = %s", i+1, formatValue(arg))
+	}
+	return strings.Join(s, ", ")
+}
+
+// formatValue formats a value like pages do, but NULL as NULL and lists and objects as JSON.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []any, map[string]any:
+		b, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonValue converts a value of a result into a value that encodes as JSON like it is rendered, e.g. decimals
+// as exact numbers and times with their layout.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case esqlo.Decimal:
+		return json.Number(v.String())
+	case esqlo.Time:
+		return v.String()
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = jsonValue(e)
+		}
+		return l
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	}
+	return v
+}
+
+// printJSON prints the tags as a JSON list with the query, timing, columns and rows of each.
+func printJSON(w io.Writer, tags []*esqlo.SqlTag) error {
+	type column struct {
+		Name string `json:"name"`
+		Type string `json:"type,omitempty"`
+	}
+	type result struct {
+		ID         string           `json:"id"`
+		Src        string           `json:"src"`
+		Query      string           `json:"query"`
+		Args       []any            `json:"args,omitempty"`
+		DurationMs float64          `json:"duration_ms"`
+		Columns    []column         `json:"columns"`
+		Rows       []map[string]any `json:"rows"`
+		Truncated  bool             `json:"truncated,omitempty"`
+	}
+	results := make([]result, 0, len(tags))
+	for _, tag := range tags {
+		r := result{
+			ID:         tag.TableName,
+			Src:        tag.Src,
+			Query:      strings.TrimSpace(tag.Query),
+			DurationMs: float64(tag.Duration.Microseconds()) / 1000,
+			Columns:    []column{},
+			Rows:       []map[string]any{},
+			Truncated:  tag.Result.Truncated,
+		}
+		for _, arg := range tag.Args {
+			r.Args = append(r.Args, jsonValue(arg))
+		}
+		for i, col := range tag.Result.Columns {
+			r.Columns = append(r.Columns, column{Name: col, Type: tag.Result.ColumnTypes[i].Type})
+		}
+		for _, values := range tag.Result.Values {
+			row := make(map[string]any, len(values))
+			for i, v := range values {
+				row[tag.Result.Columns[i]] = jsonValue(v)
+			}
+			r.Rows = append(r.Rows, row)
+		}
+		results = append(results, r)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// printCSV prints the rows of each tag as CSV with a header, separated by empty lines. The query and timing of
+// each tag go to stderr, so the output can be redirected to a file.
+func printCSV(w io.Writer, tags []*esqlo.SqlTag) error {
+	for i, tag := range tags {
+		fmt.Fprintf(os.Stderr, "-- %s: %s\n", tag.TableName, summary(tag))
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(tag.Result.Columns)
+		for _, values := range tag.Result.Values {
+			record := make([]string, len(values))
+			for i, v := range values {
+				if v != nil {
+					record[i] = formatValue(v)
+				}
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}